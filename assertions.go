@@ -0,0 +1,225 @@
+package scraper
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// BodyAssertions are checks on the body of responses. A scrape fails if any
+// of them fails.
+type BodyAssertions struct {
+	// Regular expressions the body must match.
+	MustMatch []string `yaml:"must_match"`
+	// Regular expressions the body must not match.
+	MustNotMatch []string `yaml:"must_not_match"`
+	// Substrings the body must contain.
+	Contains []string `yaml:"contains"`
+	// Substrings the body must not contain.
+	NotContains []string `yaml:"not_contains"`
+	// Checks on the values of a JSON body.
+	JSON []JSONAssertion `yaml:"json"`
+}
+
+// JSONAssertion checks a value of a JSON body.
+type JSONAssertion struct {
+	// The path of the value in gjson syntax, such as status or
+	// checks.#(name=="db").status.
+	Path string `yaml:"path"`
+	// The expected value. If empty, the value must only exist.
+	Value string `yaml:"value"`
+}
+
+// empty reports whether there are no assertions, so the body need not be
+// read.
+func (a BodyAssertions) empty() bool {
+	return len(a.MustMatch) == 0 && len(a.MustNotMatch) == 0 &&
+		len(a.Contains) == 0 && len(a.NotContains) == 0 && len(a.JSON) == 0
+}
+
+// merge returns the assertions together with those of o.
+func (a BodyAssertions) merge(o BodyAssertions) BodyAssertions {
+	return BodyAssertions{
+		MustMatch:    append(append([]string(nil), a.MustMatch...), o.MustMatch...),
+		MustNotMatch: append(append([]string(nil), a.MustNotMatch...), o.MustNotMatch...),
+		Contains:     append(append([]string(nil), a.Contains...), o.Contains...),
+		NotContains:  append(append([]string(nil), a.NotContains...), o.NotContains...),
+		JSON:         append(append([]JSONAssertion(nil), a.JSON...), o.JSON...),
+	}
+}
+
+// validate checks the regular expressions and JSON paths.
+func (a BodyAssertions) validate(pos position) error {
+	for i, re := range a.MustMatch {
+		if _, err := regexp.Compile(re); err != nil {
+			return pos.key("must_match").index(i).errorf("invalid regexp %q: %s", re, err)
+		}
+	}
+	for i, re := range a.MustNotMatch {
+		if _, err := regexp.Compile(re); err != nil {
+			return pos.key("must_not_match").index(i).errorf("invalid regexp %q: %s", re, err)
+		}
+	}
+	for i, ja := range a.JSON {
+		if ja.Path == "" {
+			return pos.key("json").index(i).errorf("JSON assertion must contain a path")
+		}
+	}
+	return nil
+}
+
+// compiledBodyAssertions are body assertions with their regular expressions
+// compiled, so scrapes need not compile them.
+type compiledBodyAssertions struct {
+	BodyAssertions
+
+	mustMatch    []*regexp.Regexp
+	mustNotMatch []*regexp.Regexp
+}
+
+// compile compiles the regular expressions of the assertions.
+func (a BodyAssertions) compile() (*compiledBodyAssertions, error) {
+	c := &compiledBodyAssertions{BodyAssertions: a}
+	var err error
+	if c.mustMatch, err = compileRegexps(a.MustMatch); err != nil {
+		return nil, errors.Wrap(err, "body assertions")
+	}
+	if c.mustNotMatch, err = compileRegexps(a.MustNotMatch); err != nil {
+		return nil, errors.Wrap(err, "body assertions")
+	}
+	return c, nil
+}
+
+// compileRegexps compiles the regular expressions.
+func compileRegexps(res []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(res))
+	for _, re := range res {
+		r, err := regexp.Compile(re)
+		if err != nil {
+			return nil, errors.Errorf("invalid regexp %q: %s", re, err)
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// check returns an error describing the first assertion the body fails.
+// There are no assertions if a is nil.
+func (a *compiledBodyAssertions) check(body []byte) error {
+	if a == nil {
+		return nil
+	}
+	for _, re := range a.mustMatch {
+		if !re.Match(body) {
+			return errors.Errorf("body did not match regexp %q", re)
+		}
+	}
+	for _, re := range a.mustNotMatch {
+		if re.Match(body) {
+			return errors.Errorf("body matched regexp %q", re)
+		}
+	}
+	for _, s := range a.Contains {
+		if !bytes.Contains(body, []byte(s)) {
+			return errors.Errorf("body does not contain %q", s)
+		}
+	}
+	for _, s := range a.NotContains {
+		if bytes.Contains(body, []byte(s)) {
+			return errors.Errorf("body contains %q", s)
+		}
+	}
+	if len(a.JSON) > 0 && !gjson.ValidBytes(body) {
+		return errors.New("body is not valid JSON")
+	}
+	for _, ja := range a.JSON {
+		res := gjson.GetBytes(body, ja.Path)
+		if !res.Exists() {
+			return errors.Errorf("JSON path %q not found in body", ja.Path)
+		}
+		if ja.Value != "" && res.String() != ja.Value {
+			return errors.Errorf("JSON path %q is %q, expected %q", ja.Path, res.String(), ja.Value)
+		}
+	}
+	return nil
+}
+
+// HeaderAssertion checks a header of responses. Without a value or regex
+// the header must only be present.
+type HeaderAssertion struct {
+	// The name of the header.
+	Name string `yaml:"name"`
+	// The expected value of the header.
+	Value string `yaml:"value"`
+	// A regular expression the value of the header must match.
+	Regex string `yaml:"regex"`
+}
+
+// validateHeaderAssertions checks the header names and regular expressions.
+func validateHeaderAssertions(pos position, assertions []HeaderAssertion) error {
+	for i, ha := range assertions {
+		hpos := pos.index(i)
+		if ha.Name == "" {
+			return hpos.errorf("header assertion must contain a name")
+		}
+		if ha.Value != "" && ha.Regex != "" {
+			return hpos.errorf("at most one of value and regex must be configured for header %q", ha.Name)
+		}
+		if _, err := regexp.Compile(ha.Regex); err != nil {
+			return hpos.key("regex").errorf("invalid regexp %q: %s", ha.Regex, err)
+		}
+	}
+	return nil
+}
+
+// compiledHeaderAssertion is a header assertion with its regular expression
+// compiled.
+type compiledHeaderAssertion struct {
+	HeaderAssertion
+
+	// The compiled Regex, nil without one.
+	regex *regexp.Regexp
+}
+
+// compileHeaderAssertions compiles the regular expressions of the
+// assertions.
+func compileHeaderAssertions(assertions []HeaderAssertion) ([]compiledHeaderAssertion, error) {
+	compiled := make([]compiledHeaderAssertion, 0, len(assertions))
+	for _, ha := range assertions {
+		c := compiledHeaderAssertion{HeaderAssertion: ha}
+		if ha.Regex != "" {
+			re, err := regexp.Compile(ha.Regex)
+			if err != nil {
+				return nil, errors.Errorf("header assertions: invalid regexp %q: %s", ha.Regex, err)
+			}
+			c.regex = re
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// checkHeaders returns an error describing the first assertion the headers
+// fail.
+func checkHeaders(assertions []compiledHeaderAssertion, header http.Header) error {
+	for _, ha := range assertions {
+		values, ok := header[http.CanonicalHeaderKey(ha.Name)]
+		if !ok {
+			return errors.Errorf("header %q not found", ha.Name)
+		}
+		value := ""
+		if len(values) > 0 {
+			value = values[0]
+		}
+		if ha.Value != "" && value != ha.Value {
+			return errors.Errorf("header %q is %q, expected %q", ha.Name, value, ha.Value)
+		}
+		if ha.regex != nil && !ha.regex.MatchString(value) {
+			return errors.Errorf("header %q with value %q did not match regexp %q", ha.Name, value, ha.Regex)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package scraper
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyAssertionsCheck(t *testing.T) {
+	body := []byte(`{"status":"degraded","checks":[{"name":"db","status":"ok"},{"name":"cache","status":"down"}]}`)
+
+	for _, c := range []struct {
+		assertions BodyAssertions
+		err        string
+	}{
+		{assertions: BodyAssertions{}},
+		{assertions: BodyAssertions{MustMatch: []string{`"status":\s*"\w+"`}}},
+		{assertions: BodyAssertions{MustMatch: []string{`"status":"ok"}$`}}, err: "body did not match regexp"},
+		{assertions: BodyAssertions{MustNotMatch: []string{`"status":"(degraded|down)"`}}, err: "body matched regexp"},
+		{assertions: BodyAssertions{Contains: []string{`"name":"db"`}}},
+		{assertions: BodyAssertions{Contains: []string{`"name":"queue"`}}, err: "body does not contain \"\\\"name\\\":\\\"queue\\\"\""},
+		{assertions: BodyAssertions{NotContains: []string{"down"}}, err: "body contains \"down\""},
+		{assertions: BodyAssertions{JSON: []JSONAssertion{{Path: `checks.#(name=="db").status`, Value: "ok"}}}},
+		{assertions: BodyAssertions{JSON: []JSONAssertion{{Path: "checks.1.name"}}}},
+		{assertions: BodyAssertions{JSON: []JSONAssertion{{Path: "status", Value: "ok"}}}, err: "JSON path \"status\" is \"degraded\", expected \"ok\""},
+		{assertions: BodyAssertions{JSON: []JSONAssertion{{Path: "uptime"}}}, err: "JSON path \"uptime\" not found in body"},
+	} {
+		require.NoError(t, c.assertions.validate(position{}))
+		compiled, err := c.assertions.compile()
+		require.NoError(t, err)
+		err = compiled.check(body)
+		if c.err == "" {
+			require.NoError(t, err, "%+v", c.assertions)
+			continue
+		}
+		require.Error(t, err, "%+v", c.assertions)
+		require.Contains(t, err.Error(), c.err)
+	}
+
+	compiled, err := BodyAssertions{JSON: []JSONAssertion{{Path: "status"}}}.compile()
+	require.NoError(t, err)
+	require.EqualError(t, compiled.check([]byte("<html>")), "body is not valid JSON")
+
+	_, err = BodyAssertions{MustNotMatch: []string{"("}}.compile()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid regexp "("`)
+}
+
+func TestBodyAssertionsMerge(t *testing.T) {
+	pool := BodyAssertions{Contains: []string{"ok"}}
+	target := BodyAssertions{Contains: []string{"db"}, JSON: []JSONAssertion{{Path: "status"}}}
+
+	require.Equal(t, BodyAssertions{
+		Contains: []string{"ok", "db"},
+		JSON:     []JSONAssertion{{Path: "status"}},
+	}, pool.merge(target))
+	require.Equal(t, []string{"ok"}, pool.Contains)
+	require.Equal(t, BodyAssertions{}, BodyAssertions{}.merge(BodyAssertions{}))
+}
+
+func TestCheckHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Cache-Control", "public, max-age=300")
+	header.Set("X-App-Version", "1.4.2")
+
+	for _, c := range []struct {
+		assertion HeaderAssertion
+		err       string
+	}{
+		{assertion: HeaderAssertion{Name: "cache-control"}},
+		{assertion: HeaderAssertion{Name: "X-App-Version", Value: "1.4.2"}},
+		{assertion: HeaderAssertion{Name: "Cache-Control", Regex: `max-age=\d+`}},
+		{assertion: HeaderAssertion{Name: "ETag"}, err: `header "ETag" not found`},
+		{assertion: HeaderAssertion{Name: "X-App-Version", Value: "1.5.0"}, err: `header "X-App-Version" is "1.4.2", expected "1.5.0"`},
+		{assertion: HeaderAssertion{Name: "Cache-Control", Regex: "no-store"}, err: `header "Cache-Control" with value "public, max-age=300" did not match regexp "no-store"`},
+	} {
+		compiled, err := compileHeaderAssertions([]HeaderAssertion{c.assertion})
+		require.NoError(t, err)
+		err = checkHeaders(compiled, header)
+		if c.err == "" {
+			require.NoError(t, err)
+			continue
+		}
+		require.EqualError(t, err, c.err)
+	}
+
+	require.Error(t, validateHeaderAssertions(position{}, []HeaderAssertion{{Value: "x"}}))
+	require.Error(t, validateHeaderAssertions(position{}, []HeaderAssertion{{Name: "a", Value: "x", Regex: "x"}}))
+	require.Error(t, validateHeaderAssertions(position{}, []HeaderAssertion{{Name: "a", Regex: "("}}))
+	_, err := compileHeaderAssertions([]HeaderAssertion{{Name: "a", Regex: "("}})
+	require.Error(t, err)
+}
@@ -0,0 +1,242 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Secret is a string, such as a password, which is redacted when printed or
+// marshaled.
+type Secret string
+
+const redactedSecret = "<secret>"
+
+// String implements fmt.Stringer.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redactedSecret
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// readSecretFile returns the content of a file holding a secret, without
+// surrounding whitespace.
+func readSecretFile(filename string) (string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// BasicAuth configures HTTP basic authentication.
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
+	// A file to read the password from on every scrape.
+	PasswordFile string `yaml:"password_file"`
+}
+
+// OAuth2Config configures the OAuth2 client credentials grant. Tokens are
+// cached until they expire.
+type OAuth2Config struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret Secret `yaml:"client_secret"`
+	// A file to read the client secret from whenever a token is requested.
+	ClientSecretFile string `yaml:"client_secret_file"`
+	// The URL tokens are requested from.
+	TokenURL string `yaml:"token_url"`
+	// The scopes of the requested tokens.
+	Scopes []string `yaml:"scopes"`
+	// Parameters added to token requests.
+	EndpointParams map[string]string `yaml:"endpoint_params"`
+}
+
+// authConfigured reports whether the config sets any authentication.
+func (c HTTPConfig) authConfigured() bool {
+	return c.BasicAuth != (BasicAuth{}) || c.BearerToken != "" || c.BearerTokenFile != "" || !isZeroOAuth2(c.OAuth2)
+}
+
+// authorize sets the Authorization header of a request. Secret files are
+// read on every call.
+func (s *targetScraper) authorize(ctx context.Context, req *http.Request) error {
+	cfg := s.httpConfig
+	switch {
+	case cfg.BasicAuth != (BasicAuth{}):
+		password := string(cfg.BasicAuth.Password)
+		if cfg.BasicAuth.PasswordFile != "" {
+			var err error
+			if password, err = readSecretFile(cfg.BasicAuth.PasswordFile); err != nil {
+				return errors.Wrap(err, "reading basic auth password")
+			}
+		}
+		req.SetBasicAuth(cfg.BasicAuth.Username, password)
+	case cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+string(cfg.BearerToken))
+	case cfg.BearerTokenFile != "":
+		token, err := readSecretFile(cfg.BearerTokenFile)
+		if err != nil {
+			return errors.Wrap(err, "reading bearer token")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case !isZeroOAuth2(cfg.OAuth2):
+		token, err := s.oauth2Token.get(ctx, s.client, cfg.OAuth2)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// validateAuth checks that at most one kind of authentication is configured.
+func (c *HTTPConfig) validateAuth(pos position) error {
+	kinds := 0
+	if c.BasicAuth != (BasicAuth{}) {
+		kinds++
+		if c.BasicAuth.Password != "" && c.BasicAuth.PasswordFile != "" {
+			return pos.key("basic_auth").errorf("at most one of password and password_file must be configured")
+		}
+	}
+	if c.BearerToken != "" || c.BearerTokenFile != "" {
+		kinds++
+		if c.BearerToken != "" && c.BearerTokenFile != "" {
+			return pos.key("bearer_token_file").errorf("at most one of bearer_token and bearer_token_file must be configured")
+		}
+	}
+	if !isZeroOAuth2(c.OAuth2) {
+		kinds++
+		opos := pos.key("oauth2")
+		if c.OAuth2.ClientID == "" {
+			return opos.errorf("oauth2 requires a client_id")
+		}
+		if c.OAuth2.ClientSecret != "" && c.OAuth2.ClientSecretFile != "" {
+			return opos.errorf("at most one of client_secret and client_secret_file must be configured")
+		}
+		u, err := url.Parse(c.OAuth2.TokenURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return opos.key("token_url").errorf("invalid token_url %q", c.OAuth2.TokenURL)
+		}
+	}
+	if kinds > 1 {
+		return pos.errorf("at most one of basic_auth, bearer_token and oauth2 must be configured")
+	}
+	return nil
+}
+
+// isZeroOAuth2 reports whether no OAuth2 setting is configured.
+func isZeroOAuth2(c OAuth2Config) bool {
+	return c.ClientID == "" && c.ClientSecret == "" && c.ClientSecretFile == "" &&
+		c.TokenURL == "" && len(c.Scopes) == 0 && len(c.EndpointParams) == 0
+}
+
+// oauth2Token caches the token of an OAuth2 config.
+type oauth2Token struct {
+	mtx    sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// tokenExpiryDelta is how long before their expiry tokens are renewed.
+const tokenExpiryDelta = 10 * time.Second
+
+// get returns the cached token, requesting a new one with the client if
+// there is none or it is about to expire.
+func (t *oauth2Token) get(ctx context.Context, client doer, cfg OAuth2Config) (string, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.token != "" && (t.expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.expiry)) {
+		return t.token, nil
+	}
+	token, expiry, err := requestOAuth2Token(ctx, client, cfg)
+	if err != nil {
+		return "", errors.Wrap(err, "requesting OAuth2 token")
+	}
+	t.token, t.expiry = token, expiry
+	return token, nil
+}
+
+// reset drops the cached token, such as after it was rejected, so that the
+// next call of get requests a new one.
+func (t *oauth2Token) reset() {
+	t.mtx.Lock()
+	t.token, t.expiry = "", time.Time{}
+	t.mtx.Unlock()
+}
+
+// requestOAuth2Token requests a token with the client credentials grant and
+// returns it with its expiry, which is zero if the token doesn't expire.
+func requestOAuth2Token(ctx context.Context, client doer, cfg OAuth2Config) (string, time.Time, error) {
+	secret := string(cfg.ClientSecret)
+	if cfg.ClientSecretFile != "" {
+		var err error
+		if secret, err = readSecretFile(cfg.ClientSecretFile); err != nil {
+			return "", time.Time{}, errors.Wrap(err, "reading client secret")
+		}
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	for name, value := range cfg.EndpointParams {
+		form.Set(name, value)
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(secret))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", time.Time{}, errors.Errorf("token endpoint returned HTTP status %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "decoding token response")
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("token response contains no access_token")
+	}
+	var expiry time.Time
+	if token.ExpiresIn > 0 {
+		expiry = start.Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token.AccessToken, expiry, nil
+}
@@ -0,0 +1,203 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arriqaaq/boomerang"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTargetScraperScrapeAuth(t *testing.T) {
+	var (
+		mtx           sync.Mutex
+		tokenRequests int
+	)
+	tokenServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, secret, _ := r.BasicAuth()
+			if r.FormValue("grant_type") != "client_credentials" || id != "scraper" || secret != "s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			mtx.Lock()
+			tokenRequests++
+			n := tokenRequests
+			mtx.Unlock()
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600,"scope":%q}`, n, r.FormValue("scope"))
+		}),
+	)
+	defer tokenServer.Close()
+
+	var authorization string
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.Lock()
+			authorization = r.Header.Get("Authorization")
+			mtx.Unlock()
+		}),
+	)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(passwordFile, []byte("from-file\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("first"), 0600))
+
+	newScraper := func(cfg HTTPConfig) *targetScraper {
+		return &targetScraper{
+			Target: NewTarget(serverURL),
+			client: boomerang.NewHttpClient(&boomerang.ClientConfig{
+				Transport:  boomerang.DefaultTransport(),
+				MaxRetries: 1,
+			}),
+			httpConfig: cfg,
+		}
+	}
+	scrape := func(ts *targetScraper) string {
+		require.NoError(t, ts.scrape(context.Background()))
+		mtx.Lock()
+		defer mtx.Unlock()
+		return authorization
+	}
+
+	ts := newScraper(HTTPConfig{BasicAuth: BasicAuth{Username: "user", Password: "pass"}})
+	require.Equal(t, "Basic dXNlcjpwYXNz", scrape(ts))
+	// The headers of the cached request are left alone.
+	require.Empty(t, ts.req.Header.Get("Authorization"))
+
+	ts = newScraper(HTTPConfig{BasicAuth: BasicAuth{Username: "user", PasswordFile: passwordFile}})
+	require.Equal(t, "Basic dXNlcjpmcm9tLWZpbGU=", scrape(ts))
+
+	ts = newScraper(HTTPConfig{BearerToken: "abc"})
+	require.Equal(t, "Bearer abc", scrape(ts))
+
+	// Token files are read on every scrape.
+	ts = newScraper(HTTPConfig{BearerTokenFile: tokenFile})
+	require.Equal(t, "Bearer first", scrape(ts))
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("second"), 0600))
+	require.Equal(t, "Bearer second", scrape(ts))
+
+	// OAuth2 tokens are cached until they are about to expire.
+	ts = newScraper(HTTPConfig{OAuth2: OAuth2Config{
+		ClientID:     "scraper",
+		ClientSecret: "s3cret",
+		TokenURL:     tokenServer.URL,
+		Scopes:       []string{"health", "read"},
+	}})
+	require.Equal(t, "Bearer token-1", scrape(ts))
+	require.Equal(t, "Bearer token-1", scrape(ts))
+	ts.oauth2Token.expiry = time.Now().Add(5 * time.Second)
+	require.Equal(t, "Bearer token-2", scrape(ts))
+
+	ts = newScraper(HTTPConfig{OAuth2: OAuth2Config{
+		ClientID:     "scraper",
+		ClientSecret: "wrong",
+		TokenURL:     tokenServer.URL,
+	}})
+	err := ts.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requesting OAuth2 token: token endpoint returned HTTP status 401")
+
+	ts = newScraper(HTTPConfig{BearerTokenFile: filepath.Join(dir, "missing")})
+	err = ts.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "reading bearer token")
+}
+
+func TestTargetScraperScrapeOAuth2Unauthorized(t *testing.T) {
+	var (
+		mtx           sync.Mutex
+		tokenRequests int
+	)
+	tokenServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.Lock()
+			tokenRequests++
+			n := tokenRequests
+			mtx.Unlock()
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer"}`, n)
+		}),
+	)
+	defer tokenServer.Close()
+
+	// The first token, which doesn't expire, is revoked.
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "Bearer token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}),
+	)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	ts := &targetScraper{
+		Target: NewTarget(serverURL),
+		client: boomerang.NewHttpClient(&boomerang.ClientConfig{
+			Transport:  boomerang.DefaultTransport(),
+			MaxRetries: 1,
+		}),
+		httpConfig: HTTPConfig{OAuth2: OAuth2Config{
+			ClientID:     "scraper",
+			ClientSecret: "s3cret",
+			TokenURL:     tokenServer.URL,
+		}},
+	}
+	require.EqualError(t, ts.scrape(context.Background()), "server returned HTTP status 401 Unauthorized")
+	require.NoError(t, ts.scrape(context.Background()))
+	require.NoError(t, ts.scrape(context.Background()))
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.Equal(t, 2, tokenRequests)
+}
+
+func TestSecretRedacted(t *testing.T) {
+	cfg := HTTPConfig{
+		BasicAuth: BasicAuth{Username: "user", Password: "pass"},
+		OAuth2:    OAuth2Config{ClientID: "scraper", ClientSecret: "s3cret"},
+	}
+
+	require.NotContains(t, fmt.Sprintf("%v", cfg), "pass")
+	require.NotContains(t, fmt.Sprintf("%+v", cfg), "s3cret")
+
+	b, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "password: <secret>")
+	require.Contains(t, string(b), "client_secret: <secret>")
+
+	b, err = json.Marshal(cfg)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "s3cret")
+	var decoded HTTPConfig
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, Secret(redactedSecret), decoded.BasicAuth.Password)
+
+	require.Equal(t, "", Secret("").String())
+}
+
+func TestTargetHashSecrets(t *testing.T) {
+	serverURL, err := url.Parse("http://foobar.com")
+	require.NoError(t, err)
+
+	target := func(password Secret) *Target {
+		tg := NewTarget(serverURL)
+		tg.options.BasicAuth = BasicAuth{Username: "user", Password: password}
+		return tg
+	}
+	require.NotEqual(t, target("pass").hash(), target("word").hash())
+	require.Equal(t, target("pass").hash(), target("pass").hash())
+}
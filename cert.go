@@ -0,0 +1,81 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CertInfo describes the certificate chain presented by an HTTPS target.
+type CertInfo struct {
+	// The earliest expiry of the certificates of the chain.
+	NotAfter time.Time `json:"not_after"`
+	// The subject of the certificate expiring first.
+	ExpiringSubject string `json:"expiring_subject"`
+	// The issuer of the leaf certificate.
+	Issuer string `json:"issuer"`
+	// The subject of the leaf certificate.
+	Subject string `json:"subject"`
+	// The DNS names and IP addresses of the leaf certificate.
+	SANs []string `json:"sans,omitempty"`
+}
+
+// certInfo returns the details of the peer certificates of a connection, or
+// nil if it has none.
+func certInfo(state *tls.ConnectionState) *CertInfo {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := state.PeerCertificates[0]
+	info := &CertInfo{
+		NotAfter:        leaf.NotAfter,
+		ExpiringSubject: leaf.Subject.String(),
+		Issuer:          leaf.Issuer.String(),
+		Subject:         leaf.Subject.String(),
+		SANs:            certSANs(leaf),
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		if cert.NotAfter.Before(info.NotAfter) {
+			info.NotAfter = cert.NotAfter
+			info.ExpiringSubject = cert.Subject.String()
+		}
+	}
+	return info
+}
+
+// certSANs returns the sorted DNS names and IP addresses of a certificate.
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sort.Strings(sans)
+	return sans
+}
+
+// checkExpiry returns an error if a certificate of the chain expires within
+// the window from now. A zero window disables the check.
+func (c *CertInfo) checkExpiry(window time.Duration, now time.Time) error {
+	if window <= 0 {
+		return nil
+	}
+	if !c.NotAfter.After(now.Add(window)) {
+		return errors.Errorf("certificate %q expires at %s, within %s",
+			c.ExpiringSubject, c.NotAfter.UTC().Format(time.RFC3339), window)
+	}
+	return nil
+}
+
+// expiryDays returns the days until the chain expires, negative once it has.
+func (c *CertInfo) expiryDays(now time.Time) float64 {
+	return c.NotAfter.Sub(now).Hours() / 24
+}
+
+// sansLabel returns the SANs as a comma separated label value.
+func (c *CertInfo) sansLabel() string {
+	return strings.Join(c.SANs, ",")
+}
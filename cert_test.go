@@ -0,0 +1,96 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/arriqaaq/boomerang"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetScraperScrapeCert(t *testing.T) {
+	server := httptest.NewTLSServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	leaf := server.Certificate()
+
+	transport := boomerang.DefaultTransport()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	ts := &targetScraper{
+		Target: NewTarget(serverURL),
+		client: boomerang.NewHttpClient(&boomerang.ClientConfig{
+			Transport:  transport,
+			MaxRetries: 1,
+		}),
+		httpConfig: HTTPConfig{CertExpiryWindow: time.Hour},
+	}
+
+	require.NoError(t, ts.scrape(context.Background()))
+
+	var resp TargetResponse
+	ts.annotate(&resp)
+	require.NotNil(t, resp.Cert)
+	require.True(t, leaf.NotAfter.Equal(resp.Cert.NotAfter))
+	require.Equal(t, leaf.Subject.String(), resp.Cert.Subject)
+	require.Equal(t, leaf.Issuer.String(), resp.Cert.Issuer)
+	require.Contains(t, resp.Cert.SANs, "127.0.0.1")
+	require.Contains(t, resp.Cert.SANs, "example.com")
+
+	// The window reaches past the expiry of the test certificate.
+	ts.httpConfig.CertExpiryWindow = time.Until(leaf.NotAfter) + time.Hour
+	err = ts.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expires at")
+
+	// The chain is reported by failed scrapes as well.
+	ts.annotate(&resp)
+	require.NotNil(t, resp.Cert)
+}
+
+func TestCertInfo(t *testing.T) {
+	now := time.Now()
+	leaf := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "foo.com"},
+		Issuer:   pkix.Name{CommonName: "Intermediate CA"},
+		NotAfter: now.Add(90 * 24 * time.Hour),
+		DNSNames: []string{"www.foo.com", "foo.com"},
+	}
+	intermediate := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "Intermediate CA"},
+		Issuer:   pkix.Name{CommonName: "Root CA"},
+		NotAfter: now.Add(10 * 24 * time.Hour),
+	}
+
+	require.Nil(t, certInfo(nil))
+	require.Nil(t, certInfo(&tls.ConnectionState{}))
+
+	info := certInfo(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf, intermediate}})
+	require.Equal(t, &CertInfo{
+		NotAfter:        intermediate.NotAfter,
+		ExpiringSubject: "CN=Intermediate CA",
+		Issuer:          "CN=Intermediate CA",
+		Subject:         "CN=foo.com",
+		SANs:            []string{"foo.com", "www.foo.com"},
+	}, info)
+	require.Equal(t, "foo.com,www.foo.com", info.sansLabel())
+	require.InDelta(t, 10, info.expiryDays(now), 0.001)
+
+	require.NoError(t, info.checkExpiry(0, now))
+	require.NoError(t, info.checkExpiry(7*24*time.Hour, now))
+	err := info.checkExpiry(30*24*time.Hour, now)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `certificate "CN=Intermediate CA" expires at`)
+}
@@ -0,0 +1,685 @@
+package scraper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultGlobalConfig is the global config applied when a file does not set
+// the values itself.
+var DefaultGlobalConfig = GlobalConfig{
+	ScrapeInterval: 15 * time.Second,
+	ScrapeTimeout:  10 * time.Second,
+	StoreSize:      10,
+}
+
+// Config is the top-level configuration of the scraper, usually loaded from
+// a YAML or JSON file.
+type Config struct {
+	// The defaults for every scrape config.
+	GlobalConfig GlobalConfig `yaml:"global"`
+	// The scrape jobs, each of them is run by its own ScrapePool.
+	ScrapeConfigs []*ScrapeConfig `yaml:"scrape_configs"`
+}
+
+// GlobalConfig holds the settings used by scrape configs which don't set
+// their own.
+type GlobalConfig struct {
+	// How frequently to scrape targets by default.
+	ScrapeInterval time.Duration `yaml:"scrape_interval"`
+	// The default timeout when scraping targets.
+	ScrapeTimeout time.Duration `yaml:"scrape_timeout"`
+	// The default channel size for the storage.
+	StoreSize int `yaml:"store_size"`
+	// The default jitter seed.
+	JitterSeed uint64 `yaml:"jitter_seed"`
+}
+
+// ServiceDiscoveryConfig holds the sources of the targets of a scrape config.
+type ServiceDiscoveryConfig struct {
+	// List of target groups scraped by this config.
+	StaticConfigs []*TargetGroup `yaml:"static_configs"`
+	// List of file service discovery configurations.
+	FileSDConfigs []*FileSDConfig `yaml:"file_sd_configs"`
+	// List of DNS service discovery configurations.
+	DNSSDConfigs []*DNSSDConfig `yaml:"dns_sd_configs"`
+	// List of HTTP service discovery configurations.
+	HTTPSDConfigs []*HTTPSDConfig `yaml:"http_sd_configs"`
+}
+
+// Load parses the YAML or JSON input into a Config.
+func Load(b []byte) (*Config, error) {
+	cfg := &Config{GlobalConfig: DefaultGlobalConfig}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	// The document is parsed once more into a node tree which is only used
+	// to point validation errors at the offending line.
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(position{&root}); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile parses the given YAML or JSON file into a Config.
+func LoadFile(filename string) (*Config, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Load(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing config file %s", filename)
+	}
+	return cfg, nil
+}
+
+// validate checks the config and fills the scrape configs with the global
+// defaults.
+func (c *Config) validate(pos position) error {
+	g := &c.GlobalConfig
+	gpos := pos.key("global")
+
+	if g.ScrapeInterval <= 0 {
+		return gpos.key("scrape_interval").errorf("scrape_interval must be greater than zero")
+	}
+	if g.ScrapeTimeout <= 0 {
+		return gpos.key("scrape_timeout").errorf("scrape_timeout must be greater than zero")
+	}
+	if g.ScrapeTimeout > g.ScrapeInterval {
+		return gpos.key("scrape_timeout").errorf("scrape_timeout %s greater than scrape_interval %s", g.ScrapeTimeout, g.ScrapeInterval)
+	}
+	if g.StoreSize < 0 {
+		return gpos.key("store_size").errorf("store_size must not be negative")
+	}
+
+	jobNames := map[string]struct{}{}
+	for i, sc := range c.ScrapeConfigs {
+		spos := pos.key("scrape_configs").index(i)
+		if sc == nil {
+			return spos.errorf("empty scrape config")
+		}
+		if err := sc.validate(spos, g); err != nil {
+			return err
+		}
+		if _, ok := jobNames[sc.JobName]; ok {
+			return spos.key("job_name").errorf("found multiple scrape configs with job name %q", sc.JobName)
+		}
+		jobNames[sc.JobName] = struct{}{}
+	}
+	return nil
+}
+
+// validate checks the scrape config and fills unset values from the global
+// config.
+func (c *ScrapeConfig) validate(pos position, g *GlobalConfig) error {
+	if c.JobName == "" {
+		return pos.key("job_name").errorf("job_name is empty")
+	}
+
+	if c.ScrapeInterval == 0 {
+		c.ScrapeInterval = g.ScrapeInterval
+	}
+	if c.ScrapeTimeout == 0 {
+		// A global timeout longer than the job's interval is capped to it.
+		c.ScrapeTimeout = g.ScrapeTimeout
+		if c.ScrapeTimeout > c.ScrapeInterval {
+			c.ScrapeTimeout = c.ScrapeInterval
+		}
+	}
+	if c.StoreSize == 0 {
+		c.StoreSize = g.StoreSize
+	}
+	if c.JitterSeed == 0 {
+		c.JitterSeed = g.JitterSeed
+	}
+
+	if c.ScrapeInterval < 0 {
+		return pos.key("scrape_interval").errorf("scrape_interval must be greater than zero for job %q", c.JobName)
+	}
+	if c.ScrapeTimeout < 0 {
+		return pos.key("scrape_timeout").errorf("scrape_timeout must be greater than zero for job %q", c.JobName)
+	}
+	if c.ScrapeTimeout > c.ScrapeInterval {
+		return pos.key("scrape_timeout").errorf("scrape_timeout %s greater than scrape_interval %s for job %q", c.ScrapeTimeout, c.ScrapeInterval, c.JobName)
+	}
+	if c.StoreSize < 0 {
+		return pos.key("store_size").errorf("store_size must not be negative for job %q", c.JobName)
+	}
+
+	if c.Scheme != "" && !targetSchemes[c.Scheme] {
+		return pos.key("scheme").errorf("unsupported scheme %q for job %q", c.Scheme, c.JobName)
+	}
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		return pos.key("path").errorf("path %q must start with / for job %q", c.Path, c.JobName)
+	}
+
+	if err := c.HTTPConfig.validate(pos); err != nil {
+		return err
+	}
+	if err := c.TCPConfig.validate(pos.key("tcp")); err != nil {
+		return err
+	}
+	if err := c.DNSConfig.validate(pos.key("dns")); err != nil {
+		return err
+	}
+	if err := c.WebSocketConfig.validate(pos.key("websocket")); err != nil {
+		return err
+	}
+	if err := c.PingConfig.validate(pos.key("ping")); err != nil {
+		return err
+	}
+	if err := c.MailConfig.validate(pos.key("mail")); err != nil {
+		return err
+	}
+	// The files of targets' own TLS settings are only loaded once they are
+	// scraped.
+	if _, err := c.TLSConfig.newTLSConfig(); err != nil {
+		return pos.key("tls_config").errorf("invalid tls_config for job %q: %s", c.JobName, err)
+	}
+
+	if err := validateRelabelConfigs(pos.key("relabel_configs"), c.RelabelConfigs); err != nil {
+		return err
+	}
+	if err := validateRelabelConfigs(pos.key("metric_relabel_configs"), c.MetricRelabelConfigs); err != nil {
+		return err
+	}
+
+	for i, tg := range c.StaticConfigs {
+		tpos := pos.key("static_configs").index(i)
+		if tg == nil {
+			return tpos.errorf("empty target group for job %q", c.JobName)
+		}
+		if err := tg.validate(tpos); err != nil {
+			return err
+		}
+		opts, err := c.targetOptions(tg.Labels)
+		if err != nil {
+			return tpos.key("labels").errorf("invalid target group for job %q: %s", c.JobName, err)
+		}
+		for j, t := range tg.Targets {
+			u, err := c.targetURL(t)
+			if err == nil && u.Scheme == "ping" {
+				err = c.checkPingProbes(opts)
+			}
+			if err != nil {
+				return tpos.key("targets").index(j).errorf("invalid target for job %q: %s", c.JobName, err)
+			}
+		}
+	}
+
+	for i, fc := range c.FileSDConfigs {
+		fpos := pos.key("file_sd_configs").index(i)
+		if fc == nil {
+			return fpos.errorf("empty file_sd config for job %q", c.JobName)
+		}
+		if err := fc.validate(fpos); err != nil {
+			return err
+		}
+	}
+
+	for i, dc := range c.DNSSDConfigs {
+		dpos := pos.key("dns_sd_configs").index(i)
+		if dc == nil {
+			return dpos.errorf("empty dns_sd config for job %q", c.JobName)
+		}
+		if err := dc.validate(dpos); err != nil {
+			return err
+		}
+	}
+
+	for i, hc := range c.HTTPSDConfigs {
+		hpos := pos.key("http_sd_configs").index(i)
+		if hc == nil {
+			return hpos.errorf("empty http_sd config for job %q", c.JobName)
+		}
+		if err := hc.validate(hpos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the HTTP request settings.
+func (c *HTTPConfig) validate(pos position) error {
+	switch c.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		return pos.key("method").errorf("unsupported HTTP method %q", c.Method)
+	}
+	for name := range c.Headers {
+		if name == "" {
+			return pos.key("headers").errorf("empty header name")
+		}
+	}
+	if c.Body != "" && c.BodyFile != "" {
+		return pos.key("body_file").errorf("at most one of body and body_file must be configured")
+	}
+	for i, codes := range c.ValidStatusCodes {
+		if _, _, err := parseStatusCodes(codes); err != nil {
+			return pos.key("valid_status_codes").index(i).errorf("%s", err)
+		}
+	}
+	if err := c.BodyAssertions.validate(pos.key("body_assertions")); err != nil {
+		return err
+	}
+	if err := validateHeaderAssertions(pos.key("header_assertions"), c.HeaderAssertions); err != nil {
+		return err
+	}
+	for i, name := range c.ExportHeaders {
+		if headerLabelName(name) == "" {
+			return pos.key("export_headers").index(i).errorf("invalid header name %q", name)
+		}
+	}
+	if c.CertExpiryWindow < 0 {
+		return pos.key("cert_expiry_window").errorf("cert_expiry_window must not be negative")
+	}
+	if err := c.TLSConfig.validate(pos.key("tls_config")); err != nil {
+		return err
+	}
+	if err := c.validateAuth(pos); err != nil {
+		return err
+	}
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil || u.Host == "" {
+			return pos.key("proxy_url").errorf("invalid proxy_url %q", redactURL(c.ProxyURL))
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return pos.key("proxy_url").errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+	}
+	for i, host := range c.NoProxy {
+		if host == "" {
+			return pos.key("no_proxy").index(i).errorf("empty no_proxy entry")
+		}
+	}
+	if err := c.Redirects.validate(pos.key("redirects")); err != nil {
+		return err
+	}
+	return nil
+}
+
+// targetURL returns the URL of a target given either as URL or as host:port,
+// which is completed with the scheme and path of the config.
+func (c *ScrapeConfig) targetURL(s string) (*url.URL, error) {
+	return buildTargetURL(s, c.scheme(), c.Path)
+}
+
+// scheme returns the scheme of targets given as host:port.
+func (c *ScrapeConfig) scheme() string {
+	if c.Scheme == "" {
+		return "http"
+	}
+	return c.Scheme
+}
+
+// targetSchemes are the supported URL schemes of targets. Targets are probed
+// with HTTP requests or, for the other schemes, with their own prober.
+var targetSchemes = map[string]bool{
+	"http":  true,
+	"https": true,
+	"tcp":   true,
+	"dns":   true,
+	"grpc":  true,
+	"grpcs": true,
+	"ws":    true,
+	"wss":   true,
+	"ping":  true,
+	"smtp":  true,
+	"smtps": true,
+	"imap":  true,
+	"imaps": true,
+	"pop3":  true,
+	"pop3s": true,
+}
+
+// portRequired are the URL schemes of targets without a default port.
+var portRequired = map[string]bool{
+	"tcp":   true,
+	"grpc":  true,
+	"grpcs": true,
+	"ping":  true,
+}
+
+// buildTargetURL returns the URL of a target given either as URL or as
+// host:port, which is completed with the given scheme and path.
+func buildTargetURL(s, scheme, path string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = scheme + "://" + s + path
+	}
+
+	u, err := url.ParseRequestURI(s)
+	if err != nil {
+		return nil, err
+	}
+	if !targetSchemes[u.Scheme] {
+		return nil, errors.Errorf("unsupported scheme %q in %q", u.Scheme, s)
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("missing host in %q", s)
+	}
+	if portRequired[u.Scheme] && u.Port() == "" {
+		return nil, errors.Errorf("missing port in %q", s)
+	}
+	if u.Scheme == "dns" {
+		if err := validateDNSURL(u); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// targetsFromGroups creates the targets of the given target groups. The
+// labels of every target are relabeled first; targets dropped by the relabel
+// configs are skipped. Invalid targets are skipped and returned as errors.
+func (c *ScrapeConfig) targetsFromGroups(tgs []*TargetGroup) ([]*Target, []error) {
+	var (
+		targets  []*Target
+		failures []error
+	)
+	for _, tg := range tgs {
+		for _, t := range tg.Targets {
+			lset := map[string]string{
+				addressLabel:     t,
+				schemeLabel:      c.scheme(),
+				metricsPathLabel: c.Path,
+			}
+			for name, value := range tg.Labels {
+				lset[name] = value
+			}
+
+			lset = relabel(lset, c.RelabelConfigs...)
+			if lset == nil {
+				continue
+			}
+
+			u, err := buildTargetURL(lset[addressLabel], lset[schemeLabel], lset[metricsPathLabel])
+			if err != nil {
+				failures = append(failures, errors.Wrapf(err, "invalid target in group %q", tg.Source))
+				continue
+			}
+			opts, err := c.targetOptions(lset)
+			if err == nil && u.Scheme == "ping" {
+				err = c.checkPingProbes(opts)
+			}
+			if err != nil {
+				failures = append(failures, errors.Wrapf(err, "invalid target %s in group %q", u, tg.Source))
+				continue
+			}
+
+			labels := make(map[string]string, len(lset))
+			for name, value := range lset {
+				if !strings.HasPrefix(name, "__") {
+					labels[name] = value
+				}
+			}
+			targets = append(targets, NewTargetWithOptions(u, labels, opts))
+		}
+	}
+	return targets, failures
+}
+
+// targetOptions returns the settings of a target from its relabeled labels.
+// Headers are given by labels named after them, with "_" for "-", such as
+// __header_x_api_key for X-Api-Key.
+func (c *ScrapeConfig) targetOptions(lset map[string]string) (TargetOptions, error) {
+	var opts TargetOptions
+
+	if v, ok := lset[scrapeIntervalLabel]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return opts, errors.Errorf("invalid scrape interval %q", v)
+		}
+		opts.ScrapeInterval = d
+	}
+	if v, ok := lset[scrapeTimeoutLabel]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return opts, errors.Errorf("invalid scrape timeout %q", v)
+		}
+		opts.ScrapeTimeout = d
+	}
+	if v, ok := lset[certExpiryWindowLabel]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return opts, errors.Errorf("invalid certificate expiry window %q", v)
+		}
+		opts.CertExpiryWindow = d
+	}
+
+	for name, value := range lset {
+		switch {
+		case name == methodLabel:
+			opts.Method = strings.ToUpper(value)
+		case name == hostLabel:
+			opts.Host = value
+		case name == bodyLabel:
+			opts.Body = value
+		case name == bodyFileLabel:
+			opts.BodyFile = value
+		case name == validStatusCodesLabel:
+			for _, codes := range strings.Split(value, ",") {
+				opts.ValidStatusCodes = append(opts.ValidStatusCodes, strings.TrimSpace(codes))
+			}
+		case name == invertStatusCodesLabel:
+			invert, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, errors.Errorf("invalid value %q of %s", value, name)
+			}
+			opts.InvertStatusCodes = invert
+		case name == bodyMustMatchLabel:
+			opts.BodyAssertions.MustMatch = []string{value}
+		case name == bodyMustNotMatchLabel:
+			opts.BodyAssertions.MustNotMatch = []string{value}
+		case name == bodyContainsLabel:
+			opts.BodyAssertions.Contains = []string{value}
+		case name == bodyNotContainsLabel:
+			opts.BodyAssertions.NotContains = []string{value}
+		case name == bodyJSONPathLabel:
+			opts.BodyAssertions.JSON = []JSONAssertion{{Path: value, Value: lset[bodyJSONValueLabel]}}
+		case name == tlsCAFileLabel:
+			opts.TLSConfig.CAFile = value
+		case name == tlsCertFileLabel:
+			opts.TLSConfig.CertFile = value
+		case name == tlsKeyFileLabel:
+			opts.TLSConfig.KeyFile = value
+		case name == tlsServerNameLabel:
+			opts.TLSConfig.ServerName = value
+		case name == tlsInsecureSkipVerifyLabel:
+			insecure, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, errors.Errorf("invalid value %q of %s", value, name)
+			}
+			opts.TLSConfig.InsecureSkipVerify = insecure
+		case name == tlsMinVersionLabel:
+			opts.TLSConfig.MinVersion = strings.ToUpper(value)
+		case name == basicAuthUsernameLabel:
+			opts.BasicAuth.Username = value
+		case name == basicAuthPasswordLabel:
+			opts.BasicAuth.Password = Secret(value)
+		case name == basicAuthPasswordFileLabel:
+			opts.BasicAuth.PasswordFile = value
+		case name == bearerTokenLabel:
+			opts.BearerToken = Secret(value)
+		case name == bearerTokenFileLabel:
+			opts.BearerTokenFile = value
+		case name == oauth2ClientIDLabel:
+			opts.OAuth2.ClientID = value
+		case name == oauth2ClientSecretLabel:
+			opts.OAuth2.ClientSecret = Secret(value)
+		case name == oauth2ClientSecretFileLabel:
+			opts.OAuth2.ClientSecretFile = value
+		case name == oauth2TokenURLLabel:
+			opts.OAuth2.TokenURL = value
+		case name == oauth2ScopesLabel:
+			for _, scope := range strings.Split(value, ",") {
+				opts.OAuth2.Scopes = append(opts.OAuth2.Scopes, strings.TrimSpace(scope))
+			}
+		case name == proxyURLLabel:
+			opts.ProxyURL = value
+		case name == noProxyLabel:
+			for _, host := range strings.Split(value, ",") {
+				opts.NoProxy = append(opts.NoProxy, strings.TrimSpace(host))
+			}
+		case name == followRedirectsLabel:
+			follow, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, errors.Errorf("invalid value %q of %s", value, name)
+			}
+			opts.Redirects.Follow = &follow
+		case name == maxRedirectsLabel:
+			hops, err := strconv.Atoi(value)
+			if err != nil || hops <= 0 {
+				return opts, errors.Errorf("invalid value %q of %s", value, name)
+			}
+			opts.Redirects.MaxHops = hops
+		case name == finalURLRegexLabel:
+			opts.Redirects.FinalURLRegex = value
+		case name == tcpTLSLabel:
+			useTLS, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, errors.Errorf("invalid value %q of %s", value, name)
+			}
+			opts.TCP.TLS = useTLS
+		case name == tcpSendLabel:
+			opts.TCP.QueryResponse = append([]TCPQueryResponse{{Send: value}}, opts.TCP.QueryResponse...)
+		case name == tcpExpectLabel:
+			opts.TCP.QueryResponse = append(opts.TCP.QueryResponse, TCPQueryResponse{Expect: value})
+		case name == exportHeadersLabel:
+			for _, header := range strings.Split(value, ",") {
+				opts.ExportHeaders = append(opts.ExportHeaders, strings.TrimSpace(header))
+			}
+		case strings.HasPrefix(name, expectHeaderLabelPrefix) && len(name) > len(expectHeaderLabelPrefix):
+			header := strings.Replace(strings.TrimPrefix(name, expectHeaderLabelPrefix), "_", "-", -1)
+			opts.HeaderAssertions = append(opts.HeaderAssertions, HeaderAssertion{
+				Name:  http.CanonicalHeaderKey(header),
+				Value: value,
+			})
+		case strings.HasPrefix(name, headerLabelPrefix) && len(name) > len(headerLabelPrefix):
+			if opts.Headers == nil {
+				opts.Headers = map[string]string{}
+			}
+			header := strings.Replace(strings.TrimPrefix(name, headerLabelPrefix), "_", "-", -1)
+			opts.Headers[http.CanonicalHeaderKey(header)] = value
+		}
+	}
+	if err := opts.HTTPConfig.validate(position{}); err != nil {
+		return opts, err
+	}
+	if err := opts.TCP.validate(position{}); err != nil {
+		return opts, err
+	}
+
+	t := &Target{options: opts}
+	if interval, timeout := t.intervalAndTimeout(c.ScrapeInterval, c.ScrapeTimeout); timeout > interval {
+		return opts, errors.Errorf("scrape timeout %s greater than scrape interval %s", timeout, interval)
+	}
+	return opts, nil
+}
+
+// checkPingProbes checks that the probes of a ping:// target with the
+// options fit into its scrape timeout, or the last of them are never sent.
+func (c *ScrapeConfig) checkPingProbes(opts TargetOptions) error {
+	t := &Target{options: opts}
+	_, timeout := t.intervalAndTimeout(c.ScrapeInterval, c.ScrapeTimeout)
+	if d := c.PingConfig.duration(); d > timeout {
+		return errors.Errorf("ping probes take up to %s, longer than scrape timeout %s", d, timeout)
+	}
+	return nil
+}
+
+// decodeStrict decodes the node into out like Node.Decode, but fails on
+// fields unknown to out like the decoder of Load does. It is used by custom
+// unmarshalers, whose nodes are otherwise decoded leniently.
+func decodeStrict(node *yaml.Node, out interface{}, typeName string) error {
+	if node.Kind == yaml.MappingNode {
+		known := map[string]bool{}
+		t := reflect.TypeOf(out).Elem()
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name != "" && name != "-" {
+				known[name] = true
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if k := node.Content[i]; !known[k.Value] {
+				return errors.Errorf("line %d: field %s not found in type %s", k.Line, k.Value, typeName)
+			}
+		}
+	}
+	return node.Decode(out)
+}
+
+// position points at a node of a parsed YAML document. It is used to add
+// the line number to validation errors.
+type position struct {
+	node *yaml.Node
+}
+
+// key returns the position of the value of the given key. If the key is not
+// set, the position of the enclosing mapping is returned.
+func (p position) key(name string) position {
+	n := p.node
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	if n == nil || n.Kind != yaml.MappingNode {
+		return position{n}
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == name {
+			return position{n.Content[i+1]}
+		}
+	}
+	return position{n}
+}
+
+// index returns the position of the i-th item of a sequence.
+func (p position) index(i int) position {
+	n := p.node
+	if n == nil || n.Kind != yaml.SequenceNode || i >= len(n.Content) {
+		return p
+	}
+	return position{n.Content[i]}
+}
+
+// line returns the line of the position, or 0 if it is unknown.
+func (p position) line() int {
+	if p.node == nil {
+		return 0
+	}
+	return p.node.Line
+}
+
+// errorf returns an error prefixed with the line of the position.
+func (p position) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if l := p.line(); l > 0 {
+		return errors.Errorf("line %d: %s", l, msg)
+	}
+	return errors.New(msg)
+}
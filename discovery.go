@@ -0,0 +1,182 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelNameRE matches valid prometheus label names.
+var labelNameRE = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// TargetGroup is a set of targets with a common label set, in the format
+// used by the Prometheus file and HTTP service discovery.
+type TargetGroup struct {
+	// The targets, given as URL or as host:port.
+	Targets []string `yaml:"targets" json:"targets"`
+	// Labels of all targets of the group.
+	Labels map[string]string `yaml:"labels" json:"labels"`
+
+	// Source identifies the group within the groups of a discoverer.
+	Source string `yaml:"-" json:"-"`
+}
+
+// validate checks the targets and labels of the group.
+func (tg *TargetGroup) validate(pos position) error {
+	for i, t := range tg.Targets {
+		if t == "" {
+			return pos.key("targets").index(i).errorf("empty target")
+		}
+	}
+	for name := range tg.Labels {
+		if !labelNameRE.MatchString(name) {
+			return pos.key("labels").errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// Discoverer provides target groups. It sends the groups which changed over
+// the channel passed to Run; a group whose targets are gone is sent with
+// its source and no targets.
+type Discoverer interface {
+	// Run sends the initial target groups, even if there are none, and all
+	// later changes until ctx is done.
+	Run(ctx context.Context, up chan<- []*TargetGroup)
+}
+
+// StaticDiscoverer provides a fixed list of target groups.
+type StaticDiscoverer []*TargetGroup
+
+// Run implements Discoverer.
+func (d StaticDiscoverer) Run(ctx context.Context, up chan<- []*TargetGroup) {
+	select {
+	case up <- d:
+	case <-ctx.Done():
+	}
+}
+
+// discoverers creates the discoverers of the config. Failed HTTP discovery
+// refreshes are counted by httpSDFailures.
+func (c *ServiceDiscoveryConfig) discoverers(httpSDFailures prometheus.Counter) []Discoverer {
+	var ds []Discoverer
+
+	if len(c.StaticConfigs) > 0 {
+		static := make(StaticDiscoverer, 0, len(c.StaticConfigs))
+		for i, tg := range c.StaticConfigs {
+			static = append(static, &TargetGroup{
+				Targets: tg.Targets,
+				Labels:  tg.Labels,
+				Source:  strconv.Itoa(i),
+			})
+		}
+		ds = append(ds, static)
+	}
+	for _, fc := range c.FileSDConfigs {
+		ds = append(ds, NewFileDiscoverer(fc))
+	}
+	for _, dc := range c.DNSSDConfigs {
+		ds = append(ds, NewDNSDiscoverer(dc))
+	}
+	for _, hc := range c.HTTPSDConfigs {
+		ds = append(ds, NewHTTPDiscoverer(hc, httpSDFailures))
+	}
+	return ds
+}
+
+// RunDiscovery runs the discoverers and syncs the targets of their groups
+// into the pool until ctx is done. The first sync waits for the initial
+// groups of all discoverers.
+func (sp *ScrapePool) RunDiscovery(ctx context.Context, ds ...Discoverer) {
+	type update struct {
+		provider int
+		tgs      []*TargetGroup
+	}
+
+	if len(ds) == 0 {
+		sp.Sync(nil)
+		return
+	}
+
+	updates := make(chan update)
+
+	for i, d := range ds {
+		ch := make(chan []*TargetGroup)
+		go d.Run(ctx, ch)
+
+		go func(provider int, ch <-chan []*TargetGroup) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case tgs := <-ch:
+					select {
+					case updates <- update{provider: provider, tgs: tgs}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}(i, ch)
+	}
+
+	var (
+		groups      = make([]map[string]*TargetGroup, len(ds))
+		initialized int
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			if groups[u.provider] == nil {
+				groups[u.provider] = map[string]*TargetGroup{}
+				initialized++
+			}
+			for _, tg := range u.tgs {
+				if tg == nil {
+					continue
+				}
+				if len(tg.Targets) == 0 {
+					delete(groups[u.provider], tg.Source)
+					continue
+				}
+				groups[u.provider][tg.Source] = tg
+			}
+
+			if initialized < len(ds) {
+				continue
+			}
+
+			var all []*TargetGroup
+			for _, provider := range groups {
+				sources := make([]string, 0, len(provider))
+				for source := range provider {
+					sources = append(sources, source)
+				}
+				sort.Strings(sources)
+				for _, source := range sources {
+					all = append(all, provider[source])
+				}
+			}
+			sp.syncGroups(all)
+		}
+	}
+}
+
+// syncGroups syncs the targets of the given groups into the pool.
+func (sp *ScrapePool) syncGroups(tgs []*TargetGroup) {
+	sp.mtx.Lock()
+	cfg := sp.config
+	sp.mtx.Unlock()
+
+	targets, failures := cfg.targetsFromGroups(tgs)
+	for _, err := range failures {
+		log.Println("msg", "Skipping target", "err", err)
+	}
+	sp.Sync(targets)
+}
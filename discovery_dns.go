@@ -0,0 +1,202 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDNSSDRefreshInterval is the interval in which the names of a DNS
+// service discovery are resolved by default.
+const DefaultDNSSDRefreshInterval = 30 * time.Second
+
+// DNSSDConfig configures the discovery of targets from DNS SRV, A or AAAA
+// records.
+type DNSSDConfig struct {
+	// The names to resolve.
+	Names []string `yaml:"names"`
+	// The record type to query, one of SRV, A or AAAA. Defaults to SRV.
+	Type string `yaml:"type"`
+	// The port of the targets for A and AAAA records.
+	Port int `yaml:"port"`
+	// How often the names are resolved.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// The address (host:port) of the DNS server to query instead of the
+	// system resolver.
+	Resolver string `yaml:"resolver"`
+}
+
+// validate checks the config and applies the defaults.
+func (c *DNSSDConfig) validate(pos position) error {
+	if len(c.Names) == 0 {
+		return pos.key("names").errorf("dns_sd config must contain at least one name")
+	}
+	for i, name := range c.Names {
+		if name == "" {
+			return pos.key("names").index(i).errorf("empty DNS name")
+		}
+	}
+
+	c.Type = strings.ToUpper(c.Type)
+	switch c.Type {
+	case "":
+		c.Type = "SRV"
+	case "SRV":
+	case "A", "AAAA":
+		if c.Port <= 0 || c.Port > 65535 {
+			return pos.key("port").errorf("a port between 1 and 65535 is required for %s queries", c.Type)
+		}
+	default:
+		return pos.key("type").errorf("invalid DNS query type %q", c.Type)
+	}
+
+	if c.Resolver != "" {
+		if _, _, err := net.SplitHostPort(c.Resolver); err != nil {
+			return pos.key("resolver").errorf("invalid resolver address %q: %s", c.Resolver, err)
+		}
+	}
+
+	if c.RefreshInterval < 0 {
+		return pos.key("refresh_interval").errorf("refresh_interval must be greater than zero")
+	}
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = DefaultDNSSDRefreshInterval
+	}
+	return nil
+}
+
+// DNSDiscoverer provides a target group for every name of a DNSSDConfig.
+// The names are resolved periodically; a group is only sent when its
+// records changed.
+type DNSDiscoverer struct {
+	names    []string
+	qtype    string
+	port     int
+	interval time.Duration
+	resolver *net.Resolver
+
+	// Targets of the groups sent last, by name.
+	last map[string][]string
+}
+
+// NewDNSDiscoverer creates a discoverer for the given config.
+func NewDNSDiscoverer(cfg *DNSSDConfig) *DNSDiscoverer {
+	d := &DNSDiscoverer{
+		names:    cfg.Names,
+		qtype:    strings.ToUpper(cfg.Type),
+		port:     cfg.Port,
+		interval: cfg.RefreshInterval,
+		resolver: net.DefaultResolver,
+		last:     map[string][]string{},
+	}
+	if d.qtype == "" {
+		d.qtype = "SRV"
+	}
+	if d.interval <= 0 {
+		d.interval = DefaultDNSSDRefreshInterval
+	}
+	if cfg.Resolver != "" {
+		addr := cfg.Resolver
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return d
+}
+
+// Run implements Discoverer.
+func (d *DNSDiscoverer) Run(ctx context.Context, up chan<- []*TargetGroup) {
+	d.refresh(ctx, up, true)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, up, false)
+		}
+	}
+}
+
+// refresh resolves all names and sends the groups which changed. Names
+// which fail to resolve, other than for not existing, keep their previous
+// targets.
+func (d *DNSDiscoverer) refresh(ctx context.Context, up chan<- []*TargetGroup, initial bool) {
+	var changed []*TargetGroup
+
+	for _, name := range d.names {
+		targets, err := d.lookup(ctx, name)
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			// The name is gone, and with it the targets of its group.
+			targets, err = nil, nil
+		}
+		if err != nil {
+			log.Println("msg", "Error resolving DNS name", "name", name, "err", err)
+			continue
+		}
+		if last, ok := d.last[name]; ok && reflect.DeepEqual(last, targets) {
+			continue
+		}
+		d.last[name] = targets
+		changed = append(changed, &TargetGroup{Targets: targets, Source: name})
+	}
+
+	if len(changed) == 0 && !initial {
+		return
+	}
+	select {
+	case up <- changed:
+	case <-ctx.Done():
+	}
+}
+
+// lookup resolves a name into sorted host:port targets.
+func (d *DNSDiscoverer) lookup(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.interval)
+	defer cancel()
+
+	var targets []string
+
+	switch d.qtype {
+	case "SRV":
+		_, srvs, err := d.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			targets = append(targets, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+		}
+	case "A", "AAAA":
+		network := "ip4"
+		if d.qtype == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := d.resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			targets = append(targets, net.JoinHostPort(ip.String(), strconv.Itoa(d.port)))
+		}
+	default:
+		return nil, errors.Errorf("invalid DNS query type %q", d.qtype)
+	}
+
+	sort.Strings(targets)
+	return targets, nil
+}
@@ -0,0 +1,161 @@
+package scraper
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// testDNSServer is a DNS stub server answering from a fixed set of records.
+type testDNSServer struct {
+	mtx     sync.Mutex
+	records map[string][]dns.RR
+
+	addr   string
+	server *dns.Server
+}
+
+// newTestDNSServer starts a DNS server on a local UDP and TCP port.
+func newTestDNSServer(t *testing.T) *testDNSServer {
+	s := &testDNSServer{records: map[string][]dns.RR{}}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	s.addr = pc.LocalAddr().String()
+
+	s.server = &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(s.serveDNS)}
+	tcpServer := &dns.Server{Listener: l, Handler: dns.HandlerFunc(s.serveDNS)}
+	go s.server.ActivateAndServe()
+	go tcpServer.ActivateAndServe()
+	t.Cleanup(func() {
+		s.server.Shutdown()
+		tcpServer.Shutdown()
+	})
+	return s
+}
+
+// setRecords replaces the records of the server by zone file lines.
+func (s *testDNSServer) setRecords(t *testing.T, lines ...string) {
+	records := map[string][]dns.RR{}
+	for _, line := range lines {
+		rr, err := dns.NewRR(line)
+		require.NoError(t, err)
+		key := rr.Header().Name + "/" + dns.TypeToString[rr.Header().Rrtype]
+		records[key] = append(records[key], rr)
+	}
+	s.mtx.Lock()
+	s.records = records
+	s.mtx.Unlock()
+}
+
+func (s *testDNSServer) serveDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	m.Answer = s.records[q.Name+"/"+dns.TypeToString[q.Qtype]]
+	if len(m.Answer) == 0 {
+		m.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(m)
+}
+
+func TestDNSDiscovererSRV(t *testing.T) {
+	server := newTestDNSServer(t)
+	server.setRecords(t,
+		"_http._tcp.web.example.com. 60 IN SRV 0 0 8080 b.example.com.",
+		"_http._tcp.web.example.com. 60 IN SRV 0 0 8081 a.example.com.",
+	)
+
+	d := NewDNSDiscoverer(&DNSSDConfig{
+		Names:           []string{"_http._tcp.web.example.com."},
+		RefreshInterval: 50 * time.Millisecond,
+		Resolver:        server.addr,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan []*TargetGroup)
+	go d.Run(ctx, ch)
+
+	groups := receiveGroups(t, ch)
+	require.Equal(t, []string{"a.example.com:8081", "b.example.com:8080"}, groups["_http._tcp.web.example.com."].Targets)
+
+	server.setRecords(t, "_http._tcp.web.example.com. 60 IN SRV 0 0 8080 b.example.com.")
+	groups = receiveGroups(t, ch)
+	require.Equal(t, []string{"b.example.com:8080"}, groups["_http._tcp.web.example.com."].Targets)
+
+	// A name that does not exist anymore has no targets.
+	server.setRecords(t)
+	groups = receiveGroups(t, ch)
+	require.Empty(t, groups["_http._tcp.web.example.com."].Targets)
+}
+
+func TestDNSDiscovererA(t *testing.T) {
+	server := newTestDNSServer(t)
+	server.setRecords(t,
+		"web.example.com. 60 IN A 10.0.0.2",
+		"web.example.com. 60 IN A 10.0.0.1",
+		"web.example.com. 60 IN AAAA ::1",
+	)
+
+	for _, c := range []struct {
+		qtype   string
+		targets []string
+	}{
+		{qtype: "A", targets: []string{"10.0.0.1:9090", "10.0.0.2:9090"}},
+		{qtype: "AAAA", targets: []string{"[::1]:9090"}},
+	} {
+		d := NewDNSDiscoverer(&DNSSDConfig{
+			Names:    []string{"web.example.com."},
+			Type:     c.qtype,
+			Port:     9090,
+			Resolver: server.addr,
+		})
+		targets, err := d.lookup(context.Background(), "web.example.com.")
+		require.NoError(t, err)
+		require.Equal(t, c.targets, targets)
+	}
+}
+
+func TestManagerDNSSD(t *testing.T) {
+	server := newTestDNSServer(t)
+	server.setRecords(t, "_http._tcp.web.example.com. 60 IN SRV 0 0 8080 a.example.com.")
+
+	cfg, err := Load([]byte(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 1h
+    path: /healthz
+    dns_sd_configs:
+      - names: ["_http._tcp.web.example.com."]
+        refresh_interval: 50ms
+        resolver: ` + server.addr + `
+`))
+	require.NoError(t, err)
+
+	m := NewManager(prometheus.NewRegistry())
+	require.NoError(t, m.ApplyConfig(cfg))
+	defer m.Stop()
+
+	sp := m.ScrapePools()["web"]
+	requireActiveTargets(t, sp, 1)
+	require.Equal(t, []string{"http://a.example.com:8080/healthz"}, activeURLs(sp))
+
+	server.setRecords(t,
+		"_http._tcp.web.example.com. 60 IN SRV 0 0 8080 a.example.com.",
+		"_http._tcp.web.example.com. 60 IN SRV 0 0 8080 b.example.com.",
+	)
+	requireActiveTargets(t, sp, 2)
+}
@@ -0,0 +1,182 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFileSDRefreshInterval is the interval in which the files of a file
+// service discovery are re-read by default.
+const DefaultFileSDRefreshInterval = 30 * time.Second
+
+// FileSDConfig configures the discovery of targets from JSON or YAML files
+// in the file service discovery format of Prometheus.
+type FileSDConfig struct {
+	// Patterns of the files to read target groups from, such as
+	// targets/*.json.
+	Files []string `yaml:"files"`
+	// How often the files are re-read.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// validate checks the config and applies the default refresh interval.
+func (c *FileSDConfig) validate(pos position) error {
+	if len(c.Files) == 0 {
+		return pos.key("files").errorf("file_sd config must contain at least one file pattern")
+	}
+	for i, name := range c.Files {
+		if _, err := filepath.Match(name, ""); err != nil {
+			return pos.key("files").index(i).errorf("invalid file pattern %q: %s", name, err)
+		}
+		switch filepath.Ext(name) {
+		case ".json", ".yml", ".yaml":
+		default:
+			return pos.key("files").index(i).errorf("file pattern %q must end in .json, .yml or .yaml", name)
+		}
+	}
+	if c.RefreshInterval < 0 {
+		return pos.key("refresh_interval").errorf("refresh_interval must be greater than zero")
+	}
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = DefaultFileSDRefreshInterval
+	}
+	return nil
+}
+
+// FileDiscoverer provides the target groups of files matching a set of
+// patterns. The files are re-read periodically.
+type FileDiscoverer struct {
+	patterns []string
+	interval time.Duration
+
+	// Number of groups read from each file on the last refresh.
+	lastRefresh map[string]int
+}
+
+// NewFileDiscoverer creates a discoverer for the given config.
+func NewFileDiscoverer(cfg *FileSDConfig) *FileDiscoverer {
+	interval := cfg.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultFileSDRefreshInterval
+	}
+	return &FileDiscoverer{
+		patterns:    cfg.Files,
+		interval:    interval,
+		lastRefresh: map[string]int{},
+	}
+}
+
+// Run implements Discoverer.
+func (d *FileDiscoverer) Run(ctx context.Context, up chan<- []*TargetGroup) {
+	d.refresh(ctx, up)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, up)
+		}
+	}
+}
+
+// refresh reads all files and sends their groups. Groups of files which
+// disappeared are sent without targets.
+func (d *FileDiscoverer) refresh(ctx context.Context, up chan<- []*TargetGroup) {
+	var (
+		all []*TargetGroup
+		ref = map[string]int{}
+	)
+	for _, p := range d.listFiles() {
+		tgs, err := readFileGroups(p)
+		if err != nil {
+			log.Println("msg", "Error reading file", "path", p, "err", err)
+			// Keep the groups of the last successful read.
+			if n, ok := d.lastRefresh[p]; ok {
+				ref[p] = n
+			}
+			continue
+		}
+		all = append(all, tgs...)
+		ref[p] = len(tgs)
+	}
+
+	for f, n := range d.lastRefresh {
+		m := ref[f]
+		for i := m; i < n; i++ {
+			all = append(all, &TargetGroup{Source: fileSource(f, i)})
+		}
+	}
+	d.lastRefresh = ref
+
+	select {
+	case up <- all:
+	case <-ctx.Done():
+	}
+}
+
+// listFiles returns the files matching the patterns.
+func (d *FileDiscoverer) listFiles() []string {
+	var paths []string
+	for _, p := range d.patterns {
+		files, err := filepath.Glob(p)
+		if err != nil {
+			log.Println("msg", "Error expanding glob", "glob", p, "err", err)
+			continue
+		}
+		paths = append(paths, files...)
+	}
+	return paths
+}
+
+// readFileGroups reads the target groups of a file.
+func readFileGroups(filename string) ([]*TargetGroup, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var tgs []*TargetGroup
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&tgs); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+	pos := position{&root}
+	if len(root.Content) > 0 {
+		pos = position{root.Content[0]}
+	}
+
+	for i, tg := range tgs {
+		if tg == nil {
+			return nil, pos.index(i).errorf("nil target group item found (index %d)", i)
+		}
+		if err := tg.validate(pos.index(i)); err != nil {
+			return nil, errors.Wrapf(err, "invalid target group (index %d)", i)
+		}
+		tg.Source = fileSource(filename, i)
+	}
+	return tgs, nil
+}
+
+// fileSource returns the source of the i-th target group of a file.
+func fileSource(filename string, i int) string {
+	return fmt.Sprintf("%s:%d", filename, i)
+}
@@ -0,0 +1,109 @@
+package scraper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// receiveGroups returns the next groups sent by a discoverer, by source.
+func receiveGroups(t *testing.T, ch <-chan []*TargetGroup) map[string]*TargetGroup {
+	t.Helper()
+	select {
+	case tgs := <-ch:
+		groups := map[string]*TargetGroup{}
+		for _, tg := range tgs {
+			groups[tg.Source] = tg
+		}
+		return groups
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no target groups received")
+	}
+	return nil
+}
+
+func TestFileDiscoverer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		jsonFile = filepath.Join(dir, "a.json")
+		yamlFile = filepath.Join(dir, "b.yml")
+	)
+	require.NoError(t, ioutil.WriteFile(jsonFile, []byte(`[
+  {"targets": ["foo.com:80", "bar.com:80"], "labels": {"env": "prod"}},
+  {"targets": ["http://baz.com/healthz"]}
+]`), 0644))
+	require.NoError(t, ioutil.WriteFile(yamlFile, []byte(`
+- targets: ["qux.com:8080"]
+  labels:
+    team: payments
+`), 0644))
+
+	d := NewFileDiscoverer(&FileSDConfig{
+		Files:           []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yml")},
+		RefreshInterval: 50 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan []*TargetGroup)
+	go d.Run(ctx, ch)
+
+	groups := receiveGroups(t, ch)
+	require.Equal(t, 3, len(groups))
+	require.Equal(t, []string{"foo.com:80", "bar.com:80"}, groups[jsonFile+":0"].Targets)
+	require.Equal(t, map[string]string{"env": "prod"}, groups[jsonFile+":0"].Labels)
+	require.Equal(t, []string{"http://baz.com/healthz"}, groups[jsonFile+":1"].Targets)
+	require.Equal(t, map[string]string{"team": "payments"}, groups[yamlFile+":0"].Labels)
+
+	// A file that can't be read keeps its previous groups.
+	require.NoError(t, ioutil.WriteFile(yamlFile, []byte(`- targets: [`), 0644))
+	groups = receiveGroups(t, ch)
+	require.Equal(t, 2, len(groups))
+	require.NotContains(t, groups, yamlFile+":0")
+
+	// Removed groups and files are sent without targets.
+	require.NoError(t, ioutil.WriteFile(jsonFile, []byte(`[{"targets": ["foo.com:80"]}]`), 0644))
+	require.NoError(t, os.Remove(yamlFile))
+	groups = receiveGroups(t, ch)
+
+	var sources []string
+	for source := range groups {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	require.Equal(t, []string{jsonFile + ":0", jsonFile + ":1", yamlFile + ":0"}, sources)
+	require.Empty(t, groups[jsonFile+":1"].Targets)
+	require.Empty(t, groups[yamlFile+":0"].Targets)
+}
+
+func TestReadFileGroupsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "targets.yml")
+
+	for _, c := range []struct {
+		content string
+		err     string
+	}{
+		{content: "- targets: [foo.com]\n  lables: {}", err: "line 2: field lables not found"},
+		{content: "- targets: [foo.com]\n  labels: {0env: prod}", err: "line 2: invalid label name \"0env\""},
+		{content: "- targets: [foo.com]\n- targets: ['']", err: "line 2: empty target"},
+	} {
+		require.NoError(t, ioutil.WriteFile(filename, []byte(c.content), 0644))
+		_, err := readFileGroups(filename)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), c.err)
+	}
+}
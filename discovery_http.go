@@ -0,0 +1,189 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/arriqaaq/boomerang"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultHTTPSDRefreshInterval is the interval in which the target groups of
+// an HTTP service discovery are fetched by default.
+const DefaultHTTPSDRefreshInterval = 60 * time.Second
+
+// HTTPSDConfig configures the discovery of targets from an HTTP endpoint in
+// the HTTP service discovery format of Prometheus.
+type HTTPSDConfig struct {
+	// The URL to fetch the target groups from.
+	URL string `yaml:"url"`
+	// How often the target groups are fetched.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// Headers to set on the requests, such as Authorization.
+	Headers map[string]string `yaml:"headers"`
+}
+
+// validate checks the config and applies the default refresh interval.
+func (c *HTTPSDConfig) validate(pos position) error {
+	if c.URL == "" {
+		return pos.key("url").errorf("http_sd config must contain a URL")
+	}
+	u, err := url.ParseRequestURI(c.URL)
+	if err != nil {
+		return pos.key("url").errorf("invalid URL %q: %s", c.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return pos.key("url").errorf("URL %q must be an absolute http or https URL", c.URL)
+	}
+	for name := range c.Headers {
+		if name == "" {
+			return pos.key("headers").errorf("empty header name")
+		}
+	}
+	if c.RefreshInterval < 0 {
+		return pos.key("refresh_interval").errorf("refresh_interval must be greater than zero")
+	}
+	if c.RefreshInterval == 0 {
+		c.RefreshInterval = DefaultHTTPSDRefreshInterval
+	}
+	return nil
+}
+
+// HTTPDiscoverer provides the target groups returned by an HTTP endpoint.
+// The endpoint is polled periodically; if a request fails, the target
+// groups of the last successful request are kept.
+type HTTPDiscoverer struct {
+	url      string
+	headers  map[string]string
+	interval time.Duration
+	client   *boomerang.HttpClient
+	failures prometheus.Counter
+
+	// Number of groups returned by the last successful request.
+	lastGroups int
+}
+
+// NewHTTPDiscoverer creates a discoverer for the given config. Failed
+// requests are counted by the failures counter, if it is not nil.
+func NewHTTPDiscoverer(cfg *HTTPSDConfig, failures prometheus.Counter) *HTTPDiscoverer {
+	interval := cfg.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultHTTPSDRefreshInterval
+	}
+	return &HTTPDiscoverer{
+		url:      cfg.URL,
+		headers:  cfg.Headers,
+		interval: interval,
+		client: boomerang.NewHttpClient(&boomerang.ClientConfig{
+			Transport:  boomerang.DefaultTransport(),
+			Timeout:    interval,
+			MaxRetries: 1,
+		}),
+		failures: failures,
+	}
+}
+
+// Run implements Discoverer.
+func (d *HTTPDiscoverer) Run(ctx context.Context, up chan<- []*TargetGroup) {
+	d.refresh(ctx, up, true)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.refresh(ctx, up, false)
+		}
+	}
+}
+
+// refresh fetches the target groups and sends them. Groups missing from the
+// response are sent without targets.
+func (d *HTTPDiscoverer) refresh(ctx context.Context, up chan<- []*TargetGroup, initial bool) {
+	tgs, err := d.fetch(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("msg", "Error fetching target groups", "url", d.url, "err", err)
+		if d.failures != nil {
+			d.failures.Inc()
+		}
+		if !initial {
+			return
+		}
+		// There is nothing to keep yet, but the initial groups must be sent.
+		tgs = nil
+	}
+
+	for i := len(tgs); i < d.lastGroups; i++ {
+		tgs = append(tgs, &TargetGroup{Source: d.source(i)})
+	}
+	d.lastGroups = len(tgs)
+
+	select {
+	case up <- tgs:
+	case <-ctx.Done():
+	}
+}
+
+// fetch requests the target groups from the endpoint.
+func (d *HTTPDiscoverer) fetch(ctx context.Context) ([]*TargetGroup, error) {
+	req, err := http.NewRequest(http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range d.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("server returned HTTP status %s", resp.Status)
+	}
+	if mt, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+		return nil, errors.Errorf("unsupported content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	var tgs []*TargetGroup
+	if err := json.NewDecoder(resp.Body).Decode(&tgs); err != nil {
+		return nil, errors.Wrap(err, "decoding target groups")
+	}
+
+	for i, tg := range tgs {
+		if tg == nil {
+			return nil, errors.Errorf("nil target group item found (index %d)", i)
+		}
+		if err := tg.validate(position{}); err != nil {
+			return nil, errors.Wrapf(err, "invalid target group (index %d)", i)
+		}
+		tg.Source = d.source(i)
+	}
+	return tgs, nil
+}
+
+// source returns the source of the i-th target group of the endpoint.
+func (d *HTTPDiscoverer) source(i int) string {
+	return fmt.Sprintf("%s:%d", d.url, i)
+}
@@ -0,0 +1,140 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// testHTTPSDServer serves a configurable HTTP service discovery response.
+type testHTTPSDServer struct {
+	mtx    sync.Mutex
+	status int
+	body   string
+}
+
+func (s *testHTTPSDServer) set(status int, body string) {
+	s.mtx.Lock()
+	s.status, s.body = status, body
+	s.mtx.Unlock()
+}
+
+func (s *testHTTPSDServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(s.status)
+	w.Write([]byte(s.body))
+}
+
+func TestHTTPDiscoverer(t *testing.T) {
+	sd := &testHTTPSDServer{}
+	sd.set(http.StatusOK, `[
+  {"targets": ["foo.com:80"], "labels": {"env": "prod"}},
+  {"targets": ["bar.com:80"]}
+]`)
+	server := httptest.NewServer(sd)
+	defer server.Close()
+
+	failures := prometheus.NewCounter(prometheus.CounterOpts{Name: "failures"})
+	d := NewHTTPDiscoverer(&HTTPSDConfig{
+		URL:             server.URL,
+		RefreshInterval: 50 * time.Millisecond,
+		Headers:         map[string]string{"Authorization": "Bearer secret"},
+	}, failures)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan []*TargetGroup)
+	go d.Run(ctx, ch)
+
+	groups := receiveGroups(t, ch)
+	require.Equal(t, 2, len(groups))
+	require.Equal(t, []string{"foo.com:80"}, groups[server.URL+":0"].Targets)
+	require.Equal(t, map[string]string{"env": "prod"}, groups[server.URL+":0"].Labels)
+
+	// Failed requests keep the last target groups.
+	sd.set(http.StatusInternalServerError, "")
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(failures) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	select {
+	case <-ch:
+		t.Fatalf("no target groups should be sent on failures")
+	default:
+	}
+
+	sd.set(http.StatusOK, `[{"targets": ["foo.com:80"]}]`)
+	groups = receiveGroups(t, ch)
+	require.Equal(t, 2, len(groups))
+	require.Equal(t, []string{"foo.com:80"}, groups[server.URL+":0"].Targets)
+	require.Empty(t, groups[server.URL+":1"].Targets)
+}
+
+func TestHTTPDiscovererInitialFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("foo.com:80"))
+	}))
+	defer server.Close()
+
+	failures := prometheus.NewCounter(prometheus.CounterOpts{Name: "failures"})
+	d := NewHTTPDiscoverer(&HTTPSDConfig{URL: server.URL, RefreshInterval: time.Hour}, failures)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan []*TargetGroup)
+	go d.Run(ctx, ch)
+
+	// The initial groups are sent, even if there are none.
+	groups := receiveGroups(t, ch)
+	require.Empty(t, groups)
+	require.Equal(t, float64(1), testutil.ToFloat64(failures))
+}
+
+func TestManagerHTTPSD(t *testing.T) {
+	sd := &testHTTPSDServer{}
+	sd.set(http.StatusOK, `[{"targets": ["foo.com:80", "bar.com:80"]}]`)
+	server := httptest.NewServer(sd)
+	defer server.Close()
+
+	cfg, err := Load([]byte(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 1h
+    http_sd_configs:
+      - url: ` + server.URL + `
+        refresh_interval: 50ms
+        headers:
+          Authorization: Bearer secret
+`))
+	require.NoError(t, err)
+
+	m := NewManager(prometheus.NewRegistry())
+	require.NoError(t, m.ApplyConfig(cfg))
+	defer m.Stop()
+
+	sp := m.ScrapePools()["web"]
+	requireActiveTargets(t, sp, 2)
+
+	sd.set(http.StatusServiceUnavailable, "")
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(sp.httpSDFailures) >= 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 2, len(sp.ActiveTargets()))
+}
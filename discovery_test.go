@@ -0,0 +1,84 @@
+package scraper
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDiscoverer sends the target groups it receives on its channel.
+type testDiscoverer struct {
+	groups chan []*TargetGroup
+}
+
+func (d *testDiscoverer) Run(ctx context.Context, up chan<- []*TargetGroup) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tgs := <-d.groups:
+			select {
+			case up <- tgs:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// activeURLs returns the sorted URLs of the active targets of the pool.
+func activeURLs(sp *ScrapePool) []string {
+	var urls []string
+	for _, t := range sp.ActiveTargets() {
+		urls = append(urls, t.URL().String())
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestScrapePoolRunDiscovery(t *testing.T) {
+	sp, err := NewScrapePool(&ScrapeConfig{
+		ScrapeInterval: time.Hour,
+		ScrapeTimeout:  time.Second,
+		Path:           "/healthz",
+	})
+	require.NoError(t, err)
+	defer sp.Stop()
+
+	var (
+		static  = StaticDiscoverer{{Targets: []string{"http://foo.com"}, Source: "0"}}
+		dynamic = &testDiscoverer{groups: make(chan []*TargetGroup)}
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sp.RunDiscovery(ctx, static, dynamic)
+
+	// The pool is not synced before all discoverers sent their initial groups.
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, sp.ActiveTargets())
+
+	dynamic.groups <- []*TargetGroup{
+		{Targets: []string{"bar.com:8080", "baz.com"}, Source: "a"},
+		{Targets: []string{"https://qux.com"}, Source: "b"},
+	}
+	require.Eventually(t, func() bool {
+		return len(sp.ActiveTargets()) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{
+		"http://bar.com:8080/healthz",
+		"http://baz.com/healthz",
+		"http://foo.com",
+		"https://qux.com",
+	}, activeURLs(sp))
+
+	// Groups without targets are removed.
+	dynamic.groups <- []*TargetGroup{{Source: "a"}}
+	require.Eventually(t, func() bool {
+		return len(sp.ActiveTargets()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"http://foo.com", "https://qux.com"}, activeURLs(sp))
+}
@@ -0,0 +1,234 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// DNSConfig configures the probes of dns:// targets, which are the DNS
+// servers to query. The name and type of a target's query can be set by
+// its URL instead, such as dns://10.0.0.53/example.com?type=MX.
+type DNSConfig struct {
+	// The name to query.
+	QueryName string `yaml:"query_name"`
+	// The record type to query. Defaults to A.
+	QueryType string `yaml:"query_type"`
+	// The protocol of the query, udp or tcp. Defaults to udp.
+	Transport string `yaml:"transport"`
+	// The response codes of successful queries, such as NOERROR or
+	// NXDOMAIN. Defaults to NOERROR.
+	ValidRcodes []string `yaml:"valid_rcodes"`
+	// The minimum number of answer records.
+	MinAnswers int `yaml:"min_answers"`
+	// The maximum number of answer records, if set.
+	MaxAnswers *int `yaml:"max_answers"`
+	// Regular expressions which must each match an answer record, such as
+	// "IN\tA\t10\.0\.0\.1$".
+	AnswerMustMatch []string `yaml:"answer_must_match"`
+	// Regular expressions which must match no answer record.
+	AnswerMustNotMatch []string `yaml:"answer_must_not_match"`
+}
+
+// validate checks the config.
+func (c *DNSConfig) validate(pos position) error {
+	if _, ok := dns.StringToType[strings.ToUpper(c.QueryType)]; c.QueryType != "" && !ok {
+		return pos.key("query_type").errorf("invalid DNS query type %q", c.QueryType)
+	}
+	switch c.Transport {
+	case "", "udp", "tcp":
+	default:
+		return pos.key("transport").errorf("unsupported DNS transport %q", c.Transport)
+	}
+	for i, rcode := range c.ValidRcodes {
+		if _, ok := dns.StringToRcode[strings.ToUpper(rcode)]; !ok {
+			return pos.key("valid_rcodes").index(i).errorf("invalid DNS response code %q", rcode)
+		}
+	}
+	if c.MinAnswers < 0 {
+		return pos.key("min_answers").errorf("min_answers must not be negative")
+	}
+	if c.MaxAnswers != nil && *c.MaxAnswers < c.MinAnswers {
+		return pos.key("max_answers").errorf("max_answers %d less than min_answers %d", *c.MaxAnswers, c.MinAnswers)
+	}
+	for i, re := range c.AnswerMustMatch {
+		if _, err := regexp.Compile(re); err != nil {
+			return pos.key("answer_must_match").index(i).errorf("invalid regexp %q: %s", re, err)
+		}
+	}
+	for i, re := range c.AnswerMustNotMatch {
+		if _, err := regexp.Compile(re); err != nil {
+			return pos.key("answer_must_not_match").index(i).errorf("invalid regexp %q: %s", re, err)
+		}
+	}
+	return nil
+}
+
+// dnsQuery returns the name and type of the query of a dns:// target. Those
+// of its URL take precedence over the config.
+func (c *DNSConfig) dnsQuery(u *url.URL) (string, uint16, error) {
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		name = c.QueryName
+	}
+	if name == "" {
+		return "", 0, errors.New("missing DNS query name")
+	}
+
+	typ := u.Query().Get("type")
+	if typ == "" {
+		typ = c.QueryType
+	}
+	if typ == "" {
+		return dns.Fqdn(name), dns.TypeA, nil
+	}
+	qtype, ok := dns.StringToType[strings.ToUpper(typ)]
+	if !ok {
+		return "", 0, errors.Errorf("invalid DNS query type %q", typ)
+	}
+	return dns.Fqdn(name), qtype, nil
+}
+
+// validateDNSURL checks the query type of a dns:// URL.
+func validateDNSURL(u *url.URL) error {
+	if typ := u.Query().Get("type"); typ != "" {
+		if _, ok := dns.StringToType[strings.ToUpper(typ)]; !ok {
+			return errors.Errorf("invalid DNS query type %q", typ)
+		}
+	}
+	return nil
+}
+
+// dnsScraper implements the scraper interface for dns:// targets.
+type dnsScraper struct {
+	*Target
+
+	config DNSConfig
+	// The answer regexps of the config, compiled.
+	answerMustMatch    []*regexp.Regexp
+	answerMustNotMatch []*regexp.Regexp
+	// The error compiling the regexps of the config, returned by every
+	// scrape.
+	compileErr error
+}
+
+// newDNSScraper creates a scraper of the dns:// target with the config,
+// compiling the regexps of its answer checks.
+func newDNSScraper(t *Target, config DNSConfig) *dnsScraper {
+	s := &dnsScraper{
+		Target: t,
+		config: config,
+	}
+	if s.compileErr = s.compile(); s.compileErr != nil {
+		log.Println("msg", "Compiling regexps failed", "target", t.URL(), "err", s.compileErr)
+	}
+	return s
+}
+
+// compile compiles the answer regexps of the config.
+func (s *dnsScraper) compile() error {
+	var err error
+	if s.answerMustMatch, err = compileRegexps(s.config.AnswerMustMatch); err != nil {
+		return errors.Wrap(err, "answer_must_match")
+	}
+	if s.answerMustNotMatch, err = compileRegexps(s.config.AnswerMustNotMatch); err != nil {
+		return errors.Wrap(err, "answer_must_not_match")
+	}
+	return nil
+}
+
+// url returns the target's URL.
+func (s *dnsScraper) url() *url.URL {
+	return s.URL()
+}
+
+// labels returns the target's labels.
+func (s *dnsScraper) labels() map[string]string {
+	return s.Labels()
+}
+
+// annotate adds nothing; the latency of the query is the response time.
+func (s *dnsScraper) annotate(resp *TargetResponse) {}
+
+// scrape queries the target and checks its response.
+func (s *dnsScraper) scrape(ctx context.Context) error {
+	if s.compileErr != nil {
+		return s.compileErr
+	}
+	name, qtype, err := s.config.dnsQuery(s.URL())
+	if err != nil {
+		return err
+	}
+	addr := s.URL().Host
+	if s.URL().Port() == "" {
+		addr = net.JoinHostPort(s.URL().Hostname(), "53")
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	client := &dns.Client{Net: s.config.Transport}
+	resp, _, err := client.ExchangeContext(ctx, msg, addr)
+	if err != nil {
+		return err
+	}
+	return s.checkResponse(resp)
+}
+
+// checkResponse returns an error describing the first check of the config
+// the response fails.
+func (s *dnsScraper) checkResponse(resp *dns.Msg) error {
+	c := &s.config
+	rcode := dns.RcodeToString[resp.Rcode]
+	valid := resp.Rcode == dns.RcodeSuccess
+	if len(c.ValidRcodes) > 0 {
+		valid = false
+		for _, r := range c.ValidRcodes {
+			if strings.EqualFold(r, rcode) {
+				valid = true
+				break
+			}
+		}
+	}
+	if !valid {
+		return errors.Errorf("server returned DNS response code %s", rcode)
+	}
+
+	if len(resp.Answer) < c.MinAnswers {
+		return errors.Errorf("got %d answers, expected at least %d", len(resp.Answer), c.MinAnswers)
+	}
+	if c.MaxAnswers != nil && len(resp.Answer) > *c.MaxAnswers {
+		return errors.Errorf("got %d answers, expected at most %d", len(resp.Answer), *c.MaxAnswers)
+	}
+
+	answers := make([]string, 0, len(resp.Answer))
+	for _, rr := range resp.Answer {
+		answers = append(answers, rr.String())
+	}
+	for _, re := range s.answerMustMatch {
+		if !anyMatch(re, answers) {
+			return errors.Errorf("no answer matched regexp %q", re)
+		}
+	}
+	for _, re := range s.answerMustNotMatch {
+		if anyMatch(re, answers) {
+			return errors.Errorf("an answer matched regexp %q", re)
+		}
+	}
+	return nil
+}
+
+// anyMatch reports whether the regexp matches any of the strings.
+func anyMatch(re *regexp.Regexp, ss []string) bool {
+	for _, s := range ss {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
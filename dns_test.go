@@ -0,0 +1,107 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSScraperScrape(t *testing.T) {
+	server := newTestDNSServer(t)
+	server.setRecords(t,
+		"www.example.com. 60 IN A 10.0.0.1",
+		"www.example.com. 60 IN A 10.0.0.2",
+		"example.com. 60 IN MX 10 mail.example.com.",
+	)
+
+	one, two := 1, 2
+	for _, c := range []struct {
+		name   string
+		url    string
+		config DNSConfig
+		err    string
+	}{
+		{
+			name:   "query name of the config",
+			url:    "dns://" + server.addr,
+			config: DNSConfig{QueryName: "www.example.com"},
+		},
+		{
+			name: "query of the URL",
+			url:  "dns://" + server.addr + "/example.com?type=mx",
+		},
+		{
+			name:   "tcp",
+			url:    "dns://" + server.addr + "/www.example.com",
+			config: DNSConfig{Transport: "tcp"},
+		},
+		{
+			name: "missing query name",
+			url:  "dns://" + server.addr,
+			err:  "missing DNS query name",
+		},
+		{
+			name: "name error",
+			url:  "dns://" + server.addr + "/missing.example.com",
+			err:  "server returned DNS response code NXDOMAIN",
+		},
+		{
+			name:   "expected name error",
+			url:    "dns://" + server.addr + "/missing.example.com",
+			config: DNSConfig{ValidRcodes: []string{"nxdomain"}},
+		},
+		{
+			name:   "answer count",
+			url:    "dns://" + server.addr + "/www.example.com",
+			config: DNSConfig{MinAnswers: 2, MaxAnswers: &two},
+		},
+		{
+			name:   "too few answers",
+			url:    "dns://" + server.addr + "/www.example.com",
+			config: DNSConfig{MinAnswers: 3},
+			err:    "got 2 answers, expected at least 3",
+		},
+		{
+			name:   "too many answers",
+			url:    "dns://" + server.addr + "/www.example.com",
+			config: DNSConfig{MaxAnswers: &one},
+			err:    "got 2 answers, expected at most 1",
+		},
+		{
+			name: "answers",
+			url:  "dns://" + server.addr + "/www.example.com",
+			config: DNSConfig{
+				AnswerMustMatch:    []string{`\tA\t10\.0\.0\.1$`, `\tA\t10\.0\.0\.2$`},
+				AnswerMustNotMatch: []string{`\t192\.168\.`},
+			},
+		},
+		{
+			name:   "missing answer",
+			url:    "dns://" + server.addr + "/www.example.com",
+			config: DNSConfig{AnswerMustMatch: []string{`\tA\t10\.0\.0\.3$`}},
+			err:    `no answer matched regexp "\\tA\\t10\\.0\\.0\\.3$"`,
+		},
+		{
+			name:   "unwanted answer",
+			url:    "dns://" + server.addr + "/www.example.com",
+			config: DNSConfig{AnswerMustNotMatch: []string{`10\.0\.0\.2`}},
+			err:    `an answer matched regexp "10\\.0\\.0\\.2"`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			targetURL, err := url.Parse(c.url)
+			require.NoError(t, err)
+			ds := newDNSScraper(NewTarget(targetURL), c.config)
+
+			err = ds.scrape(context.Background())
+			if c.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.err)
+		})
+	}
+}
@@ -3,81 +3,692 @@ package scraper
 import (
 	"log"
 	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	model "github.com/prometheus/client_model/go"
 )
 
 // Exporter exports stats in prometheus format
 type Exporter struct {
+	mtx     sync.Mutex
 	metrics Metrics
-	entries []TargetResponse
+
+	// Metrics of targets with labels, by their joined label names.
+	labeled map[string]Metrics
+	// Rules applied to the labels of the series of committed responses.
+	metricRelabelConfigs []*RelabelConfig
+	// The series of info metrics last set per target, replaced by those of
+	// later responses.
+	info map[infoKey]infoSeries
+	// The label values of the series set per target, by target key and
+	// metric name, deleted once the target is removed.
+	targets map[string]map[string]targetSeries
+}
+
+// targetSeries are the label values of the series of a metric for a target,
+// starting with the url, and the names of the target labels among them.
+type targetSeries struct {
+	names []string
+	lvs   []string
+}
+
+// infoKey identifies the series of an info metric of a target, by the
+// metric name and the target key.
+type infoKey struct {
+	name   string
+	target string
+}
+
+// infoSeries is a series of an info metric, whose label values describe the
+// response it was set for.
+type infoSeries struct {
+	vec *prometheus.GaugeVec
+	lvs []string
 }
 
-// NewExporter creates a new exporter
+// Names of the url metrics, as seen by metric relabel configs.
+const (
+	urlUpMetricName           = "sample_external_url_up"
+	urlResponseTimeMetricName = "sample_external_url_response_time_ms"
+	urlStatusCodeMetricName   = "sample_external_url_status_code"
+	urlHeadersMetricName      = "sample_external_url_headers_info"
+	urlPhaseMetricName        = "sample_external_url_phase_duration_ms"
+	urlCertExpiryMetricName   = "sample_external_url_cert_expiry_timestamp_seconds"
+	urlCertDaysMetricName     = "sample_external_url_cert_expiry_days"
+	urlCertInfoMetricName     = "sample_external_url_cert_info"
+	urlRedirectsMetricName    = "sample_external_url_redirects"
+	urlFinalURLMetricName     = "sample_external_url_final_url_info"
+	urlPingRTTMetricName      = "sample_external_url_ping_rtt_ms"
+	urlPingLossMetricName     = "sample_external_url_ping_loss_ratio"
+)
+
+// NewExporter creates a new exporter. chSize is unused, as responses are
+// recorded in the metrics as they are committed.
 func NewExporter(options Metrics, chSize int) *Exporter {
 	return &Exporter{
 		metrics: options,
-		entries: make([]TargetResponse, 0, chSize),
+		labeled: map[string]Metrics{},
+		info:    map[infoKey]infoSeries{},
+		targets: map[string]map[string]targetSeries{},
 	}
 }
 
 // Describe describe the metrics for prometheus
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	for _, vec := range e.metrics.vecs() {
+		vec.Describe(ch)
+	}
+}
+
+// setEntries records the committed responses in the metrics. Each response
+// is observed by the histograms once, however often they are collected.
+func (e *Exporter) setEntries(entries []TargetResponse) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for _, res := range entries {
+		log.Println("export: ", res)
+
+		if names, lvs, ok := e.seriesLabels(urlUpMetricName, res); ok {
+			e.metricsFor(names).TargetURLStatus.
+				WithLabelValues(lvs...).
+				Set(float64(res.Status))
+		}
+
+		if names, lvs, ok := e.seriesLabels(urlResponseTimeMetricName, res); ok {
+			e.metricsFor(names).TargetURLResponseTime.
+				WithLabelValues(lvs...).
+				Observe(float64(res.ResponseTime.Milliseconds()))
+		}
+
+		// Only responses of HTTP targets carry a status code. The series of
+		// a target is deleted once a response lacks one, such as when the
+		// request failed.
+		if e.metrics.TargetURLStatusCode != nil {
+			if names, lvs, ok := e.seriesLabels(urlStatusCodeMetricName, res); ok {
+				codes := e.metricsFor(names).TargetURLStatusCode
+				if res.StatusCode != 0 {
+					codes.WithLabelValues(lvs...).Set(float64(res.StatusCode))
+				} else {
+					codes.DeleteLabelValues(lvs...)
+				}
+			}
+		}
 
-	e.metrics.TargetURLStatus.Describe(ch)
-	e.metrics.TargetURLResponseTime.Describe(ch)
+		// The series of a target is deleted once a response lacks headers,
+		// such as when the request failed.
+		if e.metrics.TargetURLHeaders != nil {
+			var (
+				vec *prometheus.GaugeVec
+				lvs []string
+			)
+			if res.Headers != nil {
+				names, values, ok := e.seriesLabels(urlHeadersMetricName, res)
+				if ok {
+					vec, lvs = e.metricsFor(names).TargetURLHeaders, values
+				}
+			}
+			e.setInfo(urlHeadersMetricName, res, vec, lvs)
+		}
+
+		if len(res.Phases) > 0 && e.metrics.TargetURLPhaseDuration != nil {
+			if names, lvs, ok := e.seriesLabels(urlPhaseMetricName, res, "phase"); ok {
+				for _, phase := range exportedPhases {
+					d, ok := res.Phases[phase]
+					if !ok {
+						continue
+					}
+					e.metricsFor(names).TargetURLPhaseDuration.
+						WithLabelValues(append(lvs, phase)...).
+						Observe(float64(d) / float64(time.Millisecond))
+				}
+			}
+		}
+
+		// Only responses of HTTPS targets carry a certificate chain. The
+		// series of a target are deleted once a response lacks one, such as
+		// when the scrape failed before the TLS handshake.
+		if res.Cert != nil && e.metrics.TargetURLCertExpiry != nil {
+			if names, lvs, ok := e.seriesLabels(urlCertExpiryMetricName, res); ok {
+				e.metricsFor(names).TargetURLCertExpiry.
+					WithLabelValues(lvs...).
+					Set(float64(res.Cert.NotAfter.Unix()))
+			}
+			if names, lvs, ok := e.seriesLabels(urlCertDaysMetricName, res); ok {
+				e.metricsFor(names).TargetURLCertExpiryDays.
+					WithLabelValues(lvs...).
+					Set(res.Cert.expiryDays(time.Now()))
+			}
+			var vec *prometheus.GaugeVec
+			names, lvs, ok := e.seriesLabels(urlCertInfoMetricName, res, certInfoLabels...)
+			if ok {
+				vec = e.metricsFor(names).TargetURLCertInfo
+				lvs = append(lvs, res.Cert.Issuer, res.Cert.Subject, res.Cert.sansLabel())
+			}
+			e.setInfo(urlCertInfoMetricName, res, vec, lvs)
+		} else if e.metrics.TargetURLCertExpiry != nil {
+			if names, lvs, ok := e.seriesLabels(urlCertExpiryMetricName, res); ok {
+				e.metricsFor(names).TargetURLCertExpiry.DeleteLabelValues(lvs...)
+			}
+			if names, lvs, ok := e.seriesLabels(urlCertDaysMetricName, res); ok {
+				e.metricsFor(names).TargetURLCertExpiryDays.DeleteLabelValues(lvs...)
+			}
+			e.setInfo(urlCertInfoMetricName, res, nil, nil)
+		}
+
+		// Only responses of HTTP targets carry a final URL. The series of a
+		// target are deleted once a response lacks one, such as when the
+		// request failed.
+		if res.FinalURL != "" && e.metrics.TargetURLRedirects != nil {
+			if names, lvs, ok := e.seriesLabels(urlRedirectsMetricName, res); ok {
+				e.metricsFor(names).TargetURLRedirects.
+					WithLabelValues(lvs...).
+					Set(float64(res.Redirects))
+			}
+			var vec *prometheus.GaugeVec
+			names, lvs, ok := e.seriesLabels(urlFinalURLMetricName, res, "final_url")
+			if ok {
+				vec = e.metricsFor(names).TargetURLFinalURL
+				lvs = append(lvs, res.FinalURL)
+			}
+			e.setInfo(urlFinalURLMetricName, res, vec, lvs)
+		} else if e.metrics.TargetURLRedirects != nil {
+			if names, lvs, ok := e.seriesLabels(urlRedirectsMetricName, res); ok {
+				e.metricsFor(names).TargetURLRedirects.DeleteLabelValues(lvs...)
+			}
+			e.setInfo(urlFinalURLMetricName, res, nil, nil)
+		}
+
+		// Only responses of ping:// targets carry probe statistics. Without
+		// replies there are no round trip times, and those of earlier
+		// scrapes are deleted.
+		if res.Ping != nil && e.metrics.TargetURLPingRTT != nil {
+			if names, lvs, ok := e.seriesLabels(urlPingRTTMetricName, res, "stat"); ok {
+				rtts := e.metricsFor(names).TargetURLPingRTT
+				for _, stat := range []struct {
+					name string
+					d    time.Duration
+				}{
+					{"min", res.Ping.Min},
+					{"avg", res.Ping.Avg},
+					{"max", res.Ping.Max},
+					{"jitter", res.Ping.Jitter},
+				} {
+					if res.Ping.Received == 0 {
+						rtts.DeleteLabelValues(append(lvs, stat.name)...)
+						continue
+					}
+					rtts.WithLabelValues(append(lvs, stat.name)...).
+						Set(float64(stat.d) / float64(time.Millisecond))
+				}
+			}
+			if names, lvs, ok := e.seriesLabels(urlPingLossMetricName, res); ok {
+				e.metricsFor(names).TargetURLPingLoss.
+					WithLabelValues(lvs...).
+					Set(res.Ping.LossRatio())
+			}
+		}
+	}
+}
+
+// setMetricRelabelConfigs sets the rules applied to the labels of the series.
+// The series collected so far are dropped if the rules changed. The configs
+// must be validated.
+func (e *Exporter) setMetricRelabelConfigs(cfgs []*RelabelConfig) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if reflect.DeepEqual(e.metricRelabelConfigs, cfgs) {
+		return
+	}
+	e.metricRelabelConfigs = cfgs
+	for _, vec := range e.metrics.vecs() {
+		vec.Reset()
+	}
+	e.labeled = map[string]Metrics{}
+	e.info = map[infoKey]infoSeries{}
+	e.targets = map[string]map[string]targetSeries{}
+}
+
+// deleteTarget deletes the series of the target with the URL and labels.
+func (e *Exporter) deleteTarget(u *url.URL, labels map[string]string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	key := targetKey(u, labels)
+	for _, series := range e.targets[key] {
+		e.metricsFor(series.names).deleteSeries(series.names, series.lvs)
+	}
+	delete(e.targets, key)
+	for info := range e.info {
+		if info.target == key {
+			delete(e.info, info)
+		}
+	}
 }
 
 // Collect collects data to be consumed by prometheus
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
 
-	for _, res := range e.entries {
-		log.Println("collect: ", res)
-		e.metrics.TargetURLStatus.
-			WithLabelValues(res.URL.String()).
-			Set(float64(res.Status))
+	for _, vec := range e.metrics.vecs() {
+		vec.Collect(ch)
+	}
+
+	keys := make([]string, 0, len(e.labeled))
+	for key := range e.labeled {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, vec := range e.labeled[key].vecs() {
+			vec.Collect(ch)
+		}
+	}
+}
+
+// setInfo sets the series of the named info metric with the label values to
+// 1, replacing the series set for an earlier response of the target. A nil
+// vec only deletes that series.
+func (e *Exporter) setInfo(name string, res TargetResponse, vec *prometheus.GaugeVec, lvs []string) {
+	key := infoKey{name: name, target: targetKey(res.URL, res.Labels)}
+	if last, ok := e.info[key]; ok {
+		last.vec.DeleteLabelValues(last.lvs...)
+		delete(e.info, key)
+	}
+	if vec == nil {
+		return
+	}
+	vec.WithLabelValues(lvs...).Set(1)
+	e.info[key] = infoSeries{vec: vec, lvs: lvs}
+}
+
+// seriesLabels returns the names of the target labels and the label values,
+// starting with the url, of the series of the named metric for a response.
+// ok is false if the series is dropped by the metric relabel configs. The
+// name and the constant labels can be matched by the configs, but not
+// changed. Target labels named like the given labels of the metric itself
+// are skipped. The label values are recorded as those of the target of the
+// response, whose series deleteTarget deletes.
+func (e *Exporter) seriesLabels(name string, res TargetResponse, metricLabels ...string) ([]string, []string, bool) {
+	lset := make(map[string]string, len(res.Labels)+len(e.metrics.constLabels)+1)
+	for k, v := range res.Labels {
+		lset[k] = v
+	}
+	for k, v := range e.metrics.constLabels {
+		lset[k] = v
+	}
+	lset["url"] = res.URL.String()
+
+	// The info metric carries the exported headers, which take precedence
+	// over target labels of the same name.
+	if name == urlHeadersMetricName {
+		for header, value := range res.Headers {
+			lset[headerLabelName(header)] = value
+		}
+	}
+	for _, label := range metricLabels {
+		delete(lset, label)
+	}
+
+	if len(e.metricRelabelConfigs) > 0 {
+		lset[metricNameLabel] = name
+		if lset = relabel(lset, e.metricRelabelConfigs...); lset == nil {
+			return nil, nil, false
+		}
+	}
+
+	names, values := e.targetLabels(lset)
+	lvs := append([]string{lset["url"]}, values...)
+
+	key := targetKey(res.URL, res.Labels)
+	if e.targets[key] == nil {
+		e.targets[key] = map[string]targetSeries{}
+	}
+	e.targets[key][name] = targetSeries{names: names, lvs: lvs}
+	return names, lvs, true
+}
+
+// targetKey identifies the target of responses by its URL and labels.
+func targetKey(u *url.URL, labels map[string]string) string {
+	var b strings.Builder
+	b.WriteString(u.String())
+	for _, name := range sortedLabelNames(labels) {
+		b.WriteString("\xff" + name + "\xff" + labels[name])
+	}
+	return b.String()
+}
+
+// targetLabels returns the sorted names and the values of the target labels
+// which can be exported. Invalid names, names starting with "__" and names
+// of the url and constant labels are skipped.
+func (e *Exporter) targetLabels(labels map[string]string) ([]string, []string) {
+	var names, values []string
+	for _, name := range sortedLabelNames(labels) {
+		if name == "url" || strings.HasPrefix(name, "__") || !labelNameRE.MatchString(name) {
+			continue
+		}
+		if _, ok := e.metrics.constLabels[name]; ok {
+			continue
+		}
+		names = append(names, name)
+		values = append(values, labels[name])
+	}
+	return names, values
+}
+
+// metricsFor returns the metrics of targets with the given label names.
+func (e *Exporter) metricsFor(names []string) Metrics {
+	if len(names) == 0 {
+		return e.metrics
+	}
+	key := strings.Join(names, ",")
+	metrics, ok := e.labeled[key]
+	if !ok {
+		metrics = newMetrics(e.metrics.constLabels, names...)
+		e.labeled[key] = metrics
+	}
+	return metrics
+}
 
-		e.metrics.TargetURLResponseTime.
-			WithLabelValues(res.URL.String()).
-			Observe(float64(res.ResponseTime.Milliseconds()))
+// headerLabelName returns the label name of an exported header, such as
+// x_app_version for X-App-Version, or "" if the name can't be converted.
+func headerLabelName(header string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case r == '-':
+			return '_'
+		}
+		return -1
+	}, header)
+	if len(name) != len(header) || !labelNameRE.MatchString(name) {
+		return ""
 	}
-	e.metrics.TargetURLStatus.Collect(ch)
-	e.metrics.TargetURLResponseTime.Collect(ch)
+	return name
+}
+
+// sortedLabelNames returns the names of the labels in sorted order.
+func sortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Metrics is a collection of the url metrics
 type Metrics struct {
-	TargetURLStatus       *prometheus.GaugeVec
-	TargetURLResponseTime *prometheus.HistogramVec
+	TargetURLStatus         *prometheus.GaugeVec
+	TargetURLResponseTime   *prometheus.HistogramVec
+	TargetURLStatusCode     *prometheus.GaugeVec
+	TargetURLHeaders        *prometheus.GaugeVec
+	TargetURLPhaseDuration  *prometheus.HistogramVec
+	TargetURLCertExpiry     *prometheus.GaugeVec
+	TargetURLCertExpiryDays *prometheus.GaugeVec
+	TargetURLCertInfo       *prometheus.GaugeVec
+	TargetURLRedirects      *prometheus.GaugeVec
+	TargetURLFinalURL       *prometheus.GaugeVec
+	TargetURLPingRTT        *prometheus.GaugeVec
+	TargetURLPingLoss       *prometheus.GaugeVec
+
+	// The constant labels the metrics were built with.
+	constLabels prometheus.Labels
+}
+
+// metricVec is a metric vector of Metrics.
+type metricVec interface {
+	prometheus.Collector
+	Delete(prometheus.Labels) bool
+	Reset()
+}
+
+// vecs returns the metric vectors which are set, in the order they are
+// described and collected.
+func (m Metrics) vecs() []metricVec {
+	var vecs []metricVec
+	for _, vec := range []metricVec{
+		m.TargetURLStatus,
+		m.TargetURLResponseTime,
+		m.TargetURLStatusCode,
+		m.TargetURLHeaders,
+		m.TargetURLPhaseDuration,
+		m.TargetURLCertExpiry,
+		m.TargetURLCertExpiryDays,
+		m.TargetURLCertInfo,
+		m.TargetURLRedirects,
+		m.TargetURLFinalURL,
+		m.TargetURLPingRTT,
+		m.TargetURLPingLoss,
+	} {
+		if vec != nil && !reflect.ValueOf(vec).IsNil() {
+			vecs = append(vecs, vec)
+		}
+	}
+	return vecs
+}
+
+// deleteSeries deletes the series of the metrics whose url and target labels
+// have the given values, which start with the url.
+func (m Metrics) deleteSeries(names, lvs []string) {
+	match := make(prometheus.Labels, len(names)+1)
+	match["url"] = lvs[0]
+	for i, name := range names {
+		match[name] = lvs[i+1]
+	}
+
+	for _, vec := range m.vecs() {
+		ch := make(chan prometheus.Metric)
+		go func(vec metricVec) {
+			vec.Collect(ch)
+			close(ch)
+		}(vec)
+
+		var matched []prometheus.Labels
+		for metric := range ch {
+			var pb model.Metric
+			if err := metric.Write(&pb); err != nil {
+				continue
+			}
+			labels := make(prometheus.Labels, len(pb.GetLabel()))
+			for _, pair := range pb.GetLabel() {
+				if _, ok := m.constLabels[pair.GetName()]; !ok {
+					labels[pair.GetName()] = pair.GetValue()
+				}
+			}
+			if labelsMatch(labels, match) {
+				matched = append(matched, labels)
+			}
+		}
+		for _, labels := range matched {
+			vec.Delete(labels)
+		}
+	}
 }
 
+// labelsMatch reports whether the labels have the values of all the labels
+// to match.
+func labelsMatch(labels, match prometheus.Labels) bool {
+	for name, value := range match {
+		if v, ok := labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// certInfoLabels are the labels of the certificate info metric.
+var certInfoLabels = []string{"issuer", "subject", "sans"}
+
 // NewMetrics builds a new metric options
 func NewMetrics() Metrics {
+	return newMetrics(nil)
+}
+
+// newMetrics builds the url metrics with the given constant labels. The
+// metrics are labeled by url and the given target label names.
+func newMetrics(constLabels prometheus.Labels, targetLabels ...string) Metrics {
+	labelNames := append([]string{"url"}, targetLabels...)
+
 	us := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Namespace: "sample",
-			Subsystem: "external",
-			Name:      "url_up",
-			Help:      "URL status",
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_up",
+			Help:        "URL status",
+			ConstLabels: constLabels,
 		},
-		[]string{"url"},
+		labelNames,
 	)
 
 	uRH := prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Namespace: "sample",
-			Subsystem: "external",
-			Name:      "url_response_time_ms",
-			Help:      "URL response time in milli seconds",
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_response_time_ms",
+			Help:        "URL response time in milli seconds",
+			ConstLabels: constLabels,
+		},
+		labelNames,
+	)
+
+	usc := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_status_code",
+			Help:        "HTTP status code of the last URL response",
+			ConstLabels: constLabels,
+		},
+		labelNames,
+	)
+
+	uh := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_headers_info",
+			Help:        "Values of the exported headers of the last URL response",
+			ConstLabels: constLabels,
+		},
+		labelNames,
+	)
+
+	uPD := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_phase_duration_ms",
+			Help:        "Duration of the phases of URL requests in milli seconds",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.5, 2, 15),
+		},
+		append(labelNames, "phase"),
+	)
+
+	uCE := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_cert_expiry_timestamp_seconds",
+			Help:        "Earliest expiry of the certificate chain of the last URL response as unix timestamp",
+			ConstLabels: constLabels,
+		},
+		labelNames,
+	)
+
+	uCD := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_cert_expiry_days",
+			Help:        "Days until the certificate chain of the last URL response expires",
+			ConstLabels: constLabels,
+		},
+		labelNames,
+	)
+
+	uCI := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_cert_info",
+			Help:        "Issuer, subject and SANs of the leaf certificate of the last URL response",
+			ConstLabels: constLabels,
+		},
+		append(append([]string(nil), labelNames...), certInfoLabels...),
+	)
+
+	uR := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_redirects",
+			Help:        "Number of redirects followed by the last URL request",
+			ConstLabels: constLabels,
+		},
+		labelNames,
+	)
+
+	uFU := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_final_url_info",
+			Help:        "URL of the last URL response after redirects",
+			ConstLabels: constLabels,
+		},
+		append(append([]string(nil), labelNames...), "final_url"),
+	)
+
+	uPR := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_ping_rtt_ms",
+			Help:        "Minimum, average, maximum and jitter of the round trip times of the last ping probes in milli seconds",
+			ConstLabels: constLabels,
+		},
+		append(append([]string(nil), labelNames...), "stat"),
+	)
+
+	uPL := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "sample",
+			Subsystem:   "external",
+			Name:        "url_ping_loss_ratio",
+			Help:        "Ratio of the last ping probes which got no reply",
+			ConstLabels: constLabels,
 		},
-		[]string{"url"},
+		labelNames,
 	)
 
 	metrics := Metrics{
-		TargetURLStatus:       us,
-		TargetURLResponseTime: uRH,
+		TargetURLStatus:         us,
+		TargetURLResponseTime:   uRH,
+		TargetURLStatusCode:     usc,
+		TargetURLHeaders:        uh,
+		TargetURLPhaseDuration:  uPD,
+		TargetURLCertExpiry:     uCE,
+		TargetURLCertExpiryDays: uCD,
+		TargetURLCertInfo:       uCI,
+		TargetURLRedirects:      uR,
+		TargetURLFinalURL:       uFU,
+		TargetURLPingRTT:        uPR,
+		TargetURLPingLoss:       uPL,
+		constLabels:             constLabels,
 	}
 
 	return metrics
@@ -7,6 +7,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	model "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
 )
 
 type metricResult struct {
@@ -85,7 +86,7 @@ func Test_Collect(t *testing.T) {
 		ResponseTime: time.Duration(2 * time.Second),
 	}
 
-	exporter.entries = []TargetResponse{expectedQueryResult}
+	exporter.setEntries([]TargetResponse{expectedQueryResult})
 
 	ch := make(chan prometheus.Metric, 10)
 
@@ -117,3 +118,561 @@ func Test_Collect(t *testing.T) {
 		t.Errorf("Want: %d, got: %d", 1, hResult.sampleCount)
 	}
 }
+
+func Test_CollectTargetLabels(t *testing.T) {
+	exporter := NewExporter(newMetrics(prometheus.Labels{"job": "web"}), 10)
+
+	fooURL, _ := url.Parse("https://foo.com")
+	barURL, _ := url.Parse("https://bar.com")
+	exporter.setEntries([]TargetResponse{
+		{URL: fooURL, Status: HealthGood, ResponseTime: time.Second},
+		{
+			URL:          barURL,
+			Labels:       map[string]string{"env": "prod", "team": "core", "job": "other", "__meta": "x"},
+			Status:       HealthBad,
+			ResponseTime: time.Second,
+		},
+	})
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	var up *model.MetricFamily
+	for _, mf := range mfs {
+		if mf.GetName() == "sample_external_url_up" {
+			up = mf
+		}
+	}
+	require.NotNil(t, up)
+	require.Len(t, up.GetMetric(), 2)
+
+	var results []map[string]string
+	for _, m := range up.GetMetric() {
+		results = append(results, labels2Map(m.GetLabel()))
+	}
+	require.ElementsMatch(t, []map[string]string{
+		{"job": "web", "url": "https://foo.com"},
+		{"job": "web", "url": "https://bar.com", "env": "prod", "team": "core"},
+	}, results)
+}
+
+func Test_CollectMetricRelabel(t *testing.T) {
+	exporter := NewExporter(newMetrics(prometheus.Labels{"job": "web"}), 10)
+
+	cfgs := []*RelabelConfig{
+		{SourceLabels: []string{"__name__", "env"}, Separator: ";", Regex: ".*_response_time_ms;dev", Action: RelabelDrop},
+		{SourceLabels: []string{"url"}, Regex: "https://(.*)", TargetLabel: "host", Replacement: "$1", Action: RelabelReplace},
+		{Regex: "env", Action: RelabelLabelDrop},
+	}
+	for _, cfg := range cfgs {
+		require.NoError(t, cfg.validate(position{}))
+	}
+	exporter.setMetricRelabelConfigs(cfgs)
+
+	fooURL, _ := url.Parse("https://foo.com")
+	exporter.setEntries([]TargetResponse{
+		{URL: fooURL, Labels: map[string]string{"env": "dev"}, Status: HealthGood, ResponseTime: time.Second},
+	})
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, mfs, 1)
+	require.Equal(t, urlUpMetricName, mfs[0].GetName())
+	require.Len(t, mfs[0].GetMetric(), 1)
+	require.Equal(t,
+		map[string]string{"job": "web", "url": "https://foo.com", "host": "foo.com"},
+		labels2Map(mfs[0].GetMetric()[0].GetLabel()),
+	)
+}
+
+func Test_CollectStatusCode(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+
+	fooURL, _ := url.Parse("https://foo.com")
+	barURL, _ := url.Parse("https://bar.com")
+	exporter.setEntries([]TargetResponse{
+		{URL: fooURL, Status: HealthGood, ResponseTime: time.Second, StatusCode: 204},
+		{URL: barURL, Status: HealthBad, ResponseTime: time.Second},
+	})
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	var codes *model.MetricFamily
+	for _, mf := range mfs {
+		if mf.GetName() == urlStatusCodeMetricName {
+			codes = mf
+		}
+	}
+	require.NotNil(t, codes)
+	require.Len(t, codes.GetMetric(), 1, "responses without status code must not be exported")
+	require.Equal(t, map[string]string{"url": "https://foo.com"}, labels2Map(codes.GetMetric()[0].GetLabel()))
+	require.Equal(t, float64(204), codes.GetMetric()[0].GetGauge().GetValue())
+}
+
+func Test_CollectStatusCodeDeleted(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	fooURL, _ := url.Parse("https://foo.com")
+	exporter.setEntries([]TargetResponse{{URL: fooURL, Status: HealthGood, StatusCode: 200}})
+	_, err := reg.Gather()
+	require.NoError(t, err)
+
+	// A failed request leaves no status code next to url_up 0.
+	exporter.setEntries([]TargetResponse{{URL: fooURL, Status: HealthBad}})
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		require.NotEqual(t, urlStatusCodeMetricName, mf.GetName())
+	}
+}
+
+func Test_CollectHeaders(t *testing.T) {
+	exporter := NewExporter(newMetrics(prometheus.Labels{"job": "web"}), 10)
+
+	fooURL, _ := url.Parse("https://foo.com")
+	exporter.setEntries([]TargetResponse{{
+		URL:          fooURL,
+		Labels:       map[string]string{"team": "core"},
+		Status:       HealthGood,
+		ResponseTime: time.Second,
+		StatusCode:   200,
+		Headers:      map[string]string{"X-App-Version": "1.4.2"},
+	}})
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	var info *model.MetricFamily
+	for _, mf := range mfs {
+		if mf.GetName() == urlHeadersMetricName {
+			info = mf
+		}
+	}
+	require.NotNil(t, info)
+	require.Len(t, info.GetMetric(), 1)
+	require.Equal(t,
+		map[string]string{"job": "web", "url": "https://foo.com", "team": "core", "x_app_version": "1.4.2"},
+		labels2Map(info.GetMetric()[0].GetLabel()),
+	)
+	require.Equal(t, float64(1), info.GetMetric()[0].GetGauge().GetValue())
+
+	require.Equal(t, "x_app_version", headerLabelName("X-App-Version"))
+	require.Equal(t, "", headerLabelName("X-Änderung"))
+}
+
+func Test_CollectHeadersReplaced(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	fooURL, _ := url.Parse("https://foo.com")
+	for _, version := range []string{"1.2", "1.3"} {
+		exporter.setEntries([]TargetResponse{{
+			URL:          fooURL,
+			Status:       HealthGood,
+			ResponseTime: time.Second,
+			StatusCode:   200,
+			Headers:      map[string]string{"X-App-Version": version},
+		}})
+		_, err := reg.Gather()
+		require.NoError(t, err)
+	}
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	var info *model.MetricFamily
+	for _, mf := range mfs {
+		if mf.GetName() == urlHeadersMetricName {
+			info = mf
+		}
+	}
+	require.NotNil(t, info)
+	require.Len(t, info.GetMetric(), 1, "series of earlier header values must be deleted")
+	require.Equal(t, "1.3", labels2Map(info.GetMetric()[0].GetLabel())["x_app_version"])
+}
+
+func Test_CollectHeadersDeleted(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	// Targets with the same URL but other labels keep their own series.
+	fooURL, _ := url.Parse("https://foo.com")
+	response := func(env string, headers map[string]string) TargetResponse {
+		return TargetResponse{
+			URL:     fooURL,
+			Labels:  map[string]string{"env": env},
+			Status:  HealthGood,
+			Headers: headers,
+		}
+	}
+	exporter.setEntries([]TargetResponse{
+		response("prod", map[string]string{"X-App-Version": "1.2"}),
+		response("staging", map[string]string{"X-App-Version": "1.3"}),
+	})
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() == urlHeadersMetricName {
+			require.Len(t, mf.GetMetric(), 2)
+		}
+	}
+
+	exporter.setEntries([]TargetResponse{
+		response("prod", nil),
+		response("staging", map[string]string{"X-App-Version": "1.3"}),
+	})
+	mfs, err = reg.Gather()
+	require.NoError(t, err)
+
+	var info *model.MetricFamily
+	for _, mf := range mfs {
+		if mf.GetName() == urlHeadersMetricName {
+			info = mf
+		}
+	}
+	require.NotNil(t, info)
+	require.Len(t, info.GetMetric(), 1, "series of failed responses must be deleted")
+	require.Equal(t,
+		map[string]string{"url": "https://foo.com", "env": "staging", "x_app_version": "1.3"},
+		labels2Map(info.GetMetric()[0].GetLabel()),
+	)
+}
+
+func Test_CollectPhases(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+
+	fooURL, _ := url.Parse("https://foo.com")
+	exporter.setEntries([]TargetResponse{{
+		URL:          fooURL,
+		Labels:       map[string]string{"phase": "beta"},
+		Status:       HealthGood,
+		ResponseTime: time.Second,
+		Phases:       map[string]time.Duration{PhaseConnect: 3 * time.Millisecond, PhaseTTFB: 250 * time.Millisecond},
+	}})
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	var durations *model.MetricFamily
+	for _, mf := range mfs {
+		if mf.GetName() == urlPhaseMetricName {
+			durations = mf
+		}
+	}
+	require.NotNil(t, durations)
+	require.Len(t, durations.GetMetric(), 2)
+
+	sums := map[string]float64{}
+	for _, m := range durations.GetMetric() {
+		labels := labels2Map(m.GetLabel())
+		require.Equal(t, "https://foo.com", labels["url"])
+		sums[labels["phase"]] = m.GetHistogram().GetSampleSum()
+	}
+	require.Equal(t, map[string]float64{PhaseConnect: 3, PhaseTTFB: 250}, sums)
+}
+
+func Test_CollectHistogramsObservedOnce(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	fooURL, _ := url.Parse("https://foo.com")
+	exporter.setEntries([]TargetResponse{{
+		URL:          fooURL,
+		Status:       HealthGood,
+		ResponseTime: time.Second,
+		Phases:       map[string]time.Duration{PhaseConnect: 3 * time.Millisecond},
+	}})
+
+	for i := 0; i < 3; i++ {
+		mfs, err := reg.Gather()
+		require.NoError(t, err)
+		for _, mf := range mfs {
+			switch mf.GetName() {
+			case urlResponseTimeMetricName, urlPhaseMetricName:
+				require.Len(t, mf.GetMetric(), 1)
+				require.Equal(t, uint64(1), mf.GetMetric()[0].GetHistogram().GetSampleCount(), mf.GetName())
+			}
+		}
+	}
+}
+
+func Test_CollectCert(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+
+	notAfter := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	fooURL, _ := url.Parse("https://foo.com")
+	barURL, _ := url.Parse("http://bar.com")
+	exporter.setEntries([]TargetResponse{{
+		URL:          fooURL,
+		Status:       HealthGood,
+		ResponseTime: time.Second,
+		Cert: &CertInfo{
+			NotAfter: notAfter,
+			Issuer:   "CN=Foo CA",
+			Subject:  "CN=foo.com",
+			SANs:     []string{"foo.com", "www.foo.com"},
+		},
+	}, {
+		URL:          barURL,
+		Status:       HealthGood,
+		ResponseTime: time.Second,
+	}})
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	families := map[string]*model.MetricFamily{}
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+
+	// Only the HTTPS target has a certificate chain.
+	expiry := families[urlCertExpiryMetricName]
+	require.NotNil(t, expiry)
+	require.Len(t, expiry.GetMetric(), 1)
+	require.Equal(t, float64(notAfter.Unix()), expiry.GetMetric()[0].GetGauge().GetValue())
+
+	days := families[urlCertDaysMetricName]
+	require.NotNil(t, days)
+	require.InDelta(t, 30, days.GetMetric()[0].GetGauge().GetValue(), 0.01)
+
+	info := families[urlCertInfoMetricName]
+	require.NotNil(t, info)
+	require.Equal(t,
+		map[string]string{"url": "https://foo.com", "issuer": "CN=Foo CA", "subject": "CN=foo.com", "sans": "foo.com,www.foo.com"},
+		labels2Map(info.GetMetric()[0].GetLabel()),
+	)
+}
+
+func Test_CollectCertReplaced(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	notAfter := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	fooURL, _ := url.Parse("https://foo.com")
+	gather := func(cert *CertInfo) map[string]*model.MetricFamily {
+		exporter.setEntries([]TargetResponse{{
+			URL:          fooURL,
+			Status:       HealthGood,
+			ResponseTime: time.Second,
+			Cert:         cert,
+		}})
+		mfs, err := reg.Gather()
+		require.NoError(t, err)
+		families := map[string]*model.MetricFamily{}
+		for _, mf := range mfs {
+			families[mf.GetName()] = mf
+		}
+		return families
+	}
+
+	gather(&CertInfo{NotAfter: notAfter, Issuer: "CN=Foo CA", Subject: "CN=foo.com"})
+
+	// A renewed certificate replaces the series of the old one.
+	families := gather(&CertInfo{NotAfter: notAfter.Add(60 * 24 * time.Hour), Issuer: "CN=Bar CA", Subject: "CN=foo.com"})
+	info := families[urlCertInfoMetricName]
+	require.NotNil(t, info)
+	require.Len(t, info.GetMetric(), 1)
+	require.Equal(t, "CN=Bar CA", labels2Map(info.GetMetric()[0].GetLabel())["issuer"])
+	require.Equal(t, float64(notAfter.Add(60*24*time.Hour).Unix()), families[urlCertExpiryMetricName].GetMetric()[0].GetGauge().GetValue())
+
+	// A response without a certificate chain deletes the series.
+	families = gather(nil)
+	require.NotContains(t, families, urlCertInfoMetricName)
+	require.NotContains(t, families, urlCertExpiryMetricName)
+	require.NotContains(t, families, urlCertDaysMetricName)
+}
+
+func Test_CollectRedirects(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+
+	fooURL, _ := url.Parse("http://foo.com")
+	barURL, _ := url.Parse("http://bar.com")
+	exporter.setEntries([]TargetResponse{{
+		URL:          fooURL,
+		Status:       HealthGood,
+		ResponseTime: time.Second,
+		StatusCode:   200,
+		Redirects:    2,
+		FinalURL:     "https://www.foo.com/",
+	}, {
+		// Without a response there is neither a redirect count nor a
+		// final URL.
+		URL:          barURL,
+		Status:       HealthBad,
+		ResponseTime: time.Second,
+	}})
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	families := map[string]*model.MetricFamily{}
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+
+	redirects := families[urlRedirectsMetricName]
+	require.NotNil(t, redirects)
+	require.Len(t, redirects.GetMetric(), 1)
+	require.Equal(t, float64(2), redirects.GetMetric()[0].GetGauge().GetValue())
+
+	finalURL := families[urlFinalURLMetricName]
+	require.NotNil(t, finalURL)
+	require.Len(t, finalURL.GetMetric(), 1)
+	require.Equal(t,
+		map[string]string{"url": "http://foo.com", "final_url": "https://www.foo.com/"},
+		labels2Map(finalURL.GetMetric()[0].GetLabel()),
+	)
+}
+
+func Test_CollectFinalURLReplaced(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	fooURL, _ := url.Parse("http://foo.com")
+	var finalURL *model.MetricFamily
+	for _, u := range []string{"https://foo.com/", "https://www.foo.com/"} {
+		exporter.setEntries([]TargetResponse{{
+			URL:          fooURL,
+			Status:       HealthGood,
+			ResponseTime: time.Second,
+			StatusCode:   200,
+			Redirects:    1,
+			FinalURL:     u,
+		}})
+		mfs, err := reg.Gather()
+		require.NoError(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() == urlFinalURLMetricName {
+				finalURL = mf
+			}
+		}
+	}
+
+	require.NotNil(t, finalURL)
+	require.Len(t, finalURL.GetMetric(), 1, "series of earlier final URLs must be deleted")
+	require.Equal(t, "https://www.foo.com/", labels2Map(finalURL.GetMetric()[0].GetLabel())["final_url"])
+}
+
+func Test_CollectFinalURLDeleted(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	fooURL, _ := url.Parse("http://foo.com")
+	exporter.setEntries([]TargetResponse{{
+		URL:        fooURL,
+		Status:     HealthGood,
+		StatusCode: 200,
+		Redirects:  1,
+		FinalURL:   "https://foo.com/",
+	}})
+	_, err := reg.Gather()
+	require.NoError(t, err)
+
+	exporter.setEntries([]TargetResponse{{URL: fooURL, Status: HealthBad}})
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		require.NotEqual(t, urlRedirectsMetricName, mf.GetName())
+		require.NotEqual(t, urlFinalURLMetricName, mf.GetName())
+	}
+}
+
+func Test_CollectPing(t *testing.T) {
+	exporter := NewExporter(NewMetrics(), 10)
+
+	fooURL, _ := url.Parse("ping://foo.com:22")
+	barURL, _ := url.Parse("ping://bar.com:22")
+	exporter.setEntries([]TargetResponse{{
+		URL:          fooURL,
+		Status:       HealthGood,
+		ResponseTime: time.Second,
+		Ping: &PingStats{
+			Sent:     4,
+			Received: 3,
+			Min:      2 * time.Millisecond,
+			Avg:      3 * time.Millisecond,
+			Max:      5 * time.Millisecond,
+			Jitter:   1500 * time.Microsecond,
+		},
+	}, {
+		// Without replies there are no round trip times.
+		URL:          barURL,
+		Status:       HealthBad,
+		ResponseTime: time.Second,
+		Ping:         &PingStats{Sent: 5},
+	}})
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(exporter))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	families := map[string]*model.MetricFamily{}
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+
+	rtts := families[urlPingRTTMetricName]
+	require.NotNil(t, rtts)
+	stats := map[string]float64{}
+	for _, m := range rtts.GetMetric() {
+		lbls := labels2Map(m.GetLabel())
+		require.Equal(t, "ping://foo.com:22", lbls["url"])
+		stats[lbls["stat"]] = m.GetGauge().GetValue()
+	}
+	require.Equal(t, map[string]float64{"min": 2, "avg": 3, "max": 5, "jitter": 1.5}, stats)
+
+	loss := families[urlPingLossMetricName]
+	require.NotNil(t, loss)
+	losses := map[string]float64{}
+	for _, m := range loss.GetMetric() {
+		losses[labels2Map(m.GetLabel())["url"]] = m.GetGauge().GetValue()
+	}
+	require.Equal(t, map[string]float64{"ping://foo.com:22": 0.25, "ping://bar.com:22": 1}, losses)
+
+	// Once every probe of the target is lost, its round trip times are
+	// deleted.
+	exporter.setEntries([]TargetResponse{{
+		URL:          fooURL,
+		Status:       HealthBad,
+		ResponseTime: time.Second,
+		Ping:         &PingStats{Sent: 4},
+	}})
+	mfs, err = reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		require.NotEqual(t, urlPingRTTMetricName, mf.GetName())
+	}
+}
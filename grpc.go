@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// GRPCConfig configures the probes of grpc:// and grpcs:// targets, which
+// are checked with the gRPC health checking protocol. grpcs:// targets are
+// connected to with TLS, using the tls_config of the scrape config. The
+// service of a target can be set by its URL instead, such as
+// grpc://10.0.0.1:9090/orders.v1.Orders.
+type GRPCConfig struct {
+	// The service whose health is checked. Defaults to the empty name, the
+	// health of the server as a whole.
+	Service string `yaml:"service"`
+	// Metadata sent with the health checks.
+	Metadata map[string]string `yaml:"metadata"`
+}
+
+// grpcService returns the service whose health is checked for a target. The
+// service of its URL takes precedence over the config.
+func (c *GRPCConfig) grpcService(u *url.URL) string {
+	if service := strings.TrimPrefix(u.Path, "/"); service != "" {
+		return service
+	}
+	return c.Service
+}
+
+// grpcScraper implements the scraper interface for grpc:// and grpcs://
+// targets.
+type grpcScraper struct {
+	*Target
+	proberTLS
+
+	config GRPCConfig
+}
+
+// newGRPCScraper creates a scraper of the grpc:// or grpcs:// target with
+// the config. grpcs:// targets use the TLS config of the HTTP config.
+func newGRPCScraper(t *Target, config GRPCConfig, httpConfig HTTPConfig) *grpcScraper {
+	s := &grpcScraper{
+		Target: t,
+		config: config,
+	}
+	if t.URL().Scheme == "grpcs" {
+		s.proberTLS = newProberTLS(t, httpConfig)
+	}
+	return s
+}
+
+// url returns the target's URL.
+func (s *grpcScraper) url() *url.URL {
+	return s.URL()
+}
+
+// labels returns the target's labels.
+func (s *grpcScraper) labels() map[string]string {
+	return s.Labels()
+}
+
+// annotate adds the certificate chain of the last connection.
+func (s *grpcScraper) annotate(resp *TargetResponse) {
+	resp.Cert = s.lastCert
+}
+
+// scrape checks the health of the target's service. Services which are not
+// serving fail the scrape; those reporting an UNKNOWN status leave the
+// target's health unknown.
+func (s *grpcScraper) scrape(ctx context.Context) error {
+	s.lastCert = nil
+	if s.tlsErr != nil {
+		return s.tlsErr
+	}
+
+	creds := insecure.NewCredentials()
+	if s.URL().Scheme == "grpcs" {
+		creds = credentials.NewTLS(s.tlsConfig)
+	}
+	conn, err := grpc.DialContext(ctx, s.URL().Host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for k, v := range s.config.Metadata {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+	service := s.config.grpcService(s.URL())
+	var p peer.Peer
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service}, grpc.Peer(&p))
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		s.lastCert = certInfo(&info.State)
+	}
+	if err != nil {
+		return errors.Wrap(err, "health check")
+	}
+	if s.lastCert != nil {
+		if err := s.lastCert.checkExpiry(s.certExpiryWindow, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	switch resp.Status {
+	case healthpb.HealthCheckResponse_SERVING:
+		return nil
+	case healthpb.HealthCheckResponse_UNKNOWN:
+		return errors.Wrapf(errHealthUnknown, "service %q reported status UNKNOWN", service)
+	default:
+		return errors.Errorf("service %q reported status %s", service, resp.Status)
+	}
+}
@@ -0,0 +1,152 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// newTestGRPCServer starts a gRPC server with the health service, which
+// records the metadata of the last health check.
+func newTestGRPCServer(t *testing.T, opts ...grpc.ServerOption) (*health.Server, string, *metadata.MD) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var md metadata.MD
+	opts = append(opts, grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ = metadata.FromIncomingContext(ctx)
+		return handler(ctx, req)
+	}))
+	server := grpc.NewServer(opts...)
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+	return hs, l.Addr().String(), &md
+}
+
+func TestGRPCScraperScrape(t *testing.T) {
+	hs, addr, _ := newTestGRPCServer(t)
+	hs.SetServingStatus("orders.v1.Orders", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("billing.v1.Billing", healthpb.HealthCheckResponse_NOT_SERVING)
+	hs.SetServingStatus("search.v1.Search", healthpb.HealthCheckResponse_UNKNOWN)
+
+	for _, c := range []struct {
+		name   string
+		url    string
+		config GRPCConfig
+		health TargetHealth
+		err    string
+	}{
+		{
+			name:   "server",
+			url:    "grpc://" + addr,
+			health: HealthGood,
+		},
+		{
+			name:   "service of the config",
+			url:    "grpc://" + addr,
+			config: GRPCConfig{Service: "orders.v1.Orders"},
+			health: HealthGood,
+		},
+		{
+			name:   "service of the URL",
+			url:    "grpc://" + addr + "/orders.v1.Orders",
+			config: GRPCConfig{Service: "billing.v1.Billing"},
+			health: HealthGood,
+		},
+		{
+			name:   "not serving",
+			url:    "grpc://" + addr + "/billing.v1.Billing",
+			health: HealthBad,
+			err:    `service "billing.v1.Billing" reported status NOT_SERVING`,
+		},
+		{
+			name:   "unknown",
+			url:    "grpc://" + addr + "/search.v1.Search",
+			health: HealthUnknown,
+			err:    `service "search.v1.Search" reported status UNKNOWN`,
+		},
+		{
+			name:   "missing service",
+			url:    "grpc://" + addr + "/payments.v1.Payments",
+			health: HealthBad,
+			err:    "code = NotFound",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			targetURL, err := url.Parse(c.url)
+			require.NoError(t, err)
+			gs := &grpcScraper{
+				Target: NewTarget(targetURL),
+				config: c.config,
+			}
+
+			err = gs.scrape(context.Background())
+			gs.report(time.Now(), time.Second, err)
+			require.Equal(t, c.health, gs.Health())
+			if c.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.err)
+		})
+	}
+}
+
+func TestGRPCScraperScrapeMetadata(t *testing.T) {
+	_, addr, md := newTestGRPCServer(t)
+
+	targetURL, _ := url.Parse("grpc://" + addr)
+	gs := &grpcScraper{
+		Target: NewTarget(targetURL),
+		config: GRPCConfig{Metadata: map[string]string{"authorization": "Bearer secret", "x-tenant": "acme"}},
+	}
+	require.NoError(t, gs.scrape(context.Background()))
+	require.Equal(t, []string{"Bearer secret"}, md.Get("authorization"))
+	require.Equal(t, []string{"acme"}, md.Get("x-tenant"))
+}
+
+func TestGRPCScraperScrapeTLS(t *testing.T) {
+	// The test server provides a certificate for example.com.
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.StartTLS()
+	serverTLS := server.TLS
+	server.Close()
+
+	_, addr, _ := newTestGRPCServer(t, grpc.Creds(credentials.NewTLS(serverTLS)))
+
+	targetURL, _ := url.Parse("grpcs://" + addr)
+	gs := newGRPCScraper(NewTarget(targetURL), GRPCConfig{}, HTTPConfig{})
+	gs.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	require.NoError(t, gs.scrape(context.Background()))
+
+	var resp TargetResponse
+	gs.annotate(&resp)
+	require.NotNil(t, resp.Cert)
+	require.Contains(t, resp.Cert.SANs, "example.com")
+
+	gs.certExpiryWindow = 100 * 365 * 24 * time.Hour
+	err := gs.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expires")
+
+	// The certificate of the test server is not trusted by default.
+	gs.tlsConfig = &tls.Config{}
+	err = gs.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "certificate")
+}
@@ -79,9 +79,6 @@ func (sl *scrapeLoop) run(interval, timeout time.Duration, errc chan<- error) {
 		case <-ticker.C:
 		}
 	}
-
-	close(sl.stopped)
-
 }
 
 // scrapeAndReport performs a scrape and then appends the result to the store
@@ -97,23 +94,28 @@ func (sl *scrapeLoop) scrapeAndReport(interval, timeout time.Duration, appendTim
 		sl.scraper.report(start, time.Since(start), scrapeErr)
 	}()
 
-	var health TargetHealth
 	scrapeCtx, cancel := context.WithTimeout(sl.ctx, timeout)
 	scrapeErr = sl.scraper.scrape(scrapeCtx)
 	cancel()
 
+	health := scrapeHealth(scrapeErr)
 	if scrapeErr != nil {
-		health = HealthBad
 		log.Println("msg", "Scrape failed", "err", scrapeErr)
 		if errc != nil {
 			errc <- scrapeErr
 		}
-	} else {
-		health = HealthGood
 	}
 
+	resp := TargetResponse{
+		URL:          sl.scraper.url(),
+		Labels:       sl.scraper.labels(),
+		Status:       health,
+		ResponseTime: time.Since(start),
+	}
+	sl.scraper.annotate(&resp)
+
 	// appending the stats to the store to make it available to the exporter.
-	app.Add(sl.scraper.url(), health, time.Since(start))
+	app.Append(resp)
 
 	return start
 }
@@ -18,6 +18,8 @@ type testScraper struct {
 
 	scrapeErr  error
 	scrapeFunc func(context.Context) error
+
+	targetLabels map[string]string
 }
 
 func (ts *testScraper) offset(interval time.Duration, jitterSeed uint64) time.Duration {
@@ -42,10 +44,18 @@ func (ts *testScraper) url() *url.URL {
 	return serverURL
 }
 
+func (ts *testScraper) labels() map[string]string {
+	return ts.targetLabels
+}
+
+func (ts *testScraper) annotate(resp *TargetResponse) {}
+
 type noStore struct{}
 
 func (a noStore) Add(url *url.URL, health TargetHealth, duration time.Duration) error { return nil }
 
+func (a noStore) Append(resp TargetResponse) error { return nil }
+
 func (a noStore) Commit() []TargetResponse { return nil }
 
 func TestScrapeLoopRun(t *testing.T) {
@@ -0,0 +1,300 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MailConfig configures the probes of mail servers: smtp://, imap:// and
+// pop3:// targets, and smtps://, imaps:// and pop3s:// targets connected to
+// with TLS. TLS connections use the tls_config of the scrape config.
+type MailConfig struct {
+	// Whether the connection is upgraded with STARTTLS, or STLS for POP3,
+	// after the banner.
+	StartTLS bool `yaml:"starttls"`
+	// The name sent with EHLO by SMTP probes. SMTP probes only send EHLO if
+	// set or for STARTTLS, with localhost by default.
+	EHLO string `yaml:"ehlo"`
+	// A regular expression the banner must match, such as "ESMTP Postfix".
+	BannerRegex string `yaml:"banner_regex"`
+}
+
+// validate checks the regular expression.
+func (c MailConfig) validate(pos position) error {
+	if _, err := regexp.Compile(c.BannerRegex); err != nil {
+		return pos.key("banner_regex").errorf("invalid regexp %q: %s", c.BannerRegex, err)
+	}
+	return nil
+}
+
+// mailProtocol is the dialog of a mail protocol.
+type mailProtocol struct {
+	// The port of the protocol.
+	port string
+	// Whether the connection is secured with TLS right away.
+	implicitTLS bool
+	// banner reads the greeting of the server.
+	banner func(conn *textproto.Conn) (string, error)
+	// hello greets the server, if the protocol does. It's called again
+	// after STARTTLS.
+	hello func(conn *textproto.Conn, name string) error
+	// startTLS asks the server to upgrade the connection to TLS.
+	startTLS func(conn *textproto.Conn) error
+	// The command ending the session.
+	quit string
+}
+
+// mailProtocols are the mail protocols by URL scheme.
+var mailProtocols = map[string]mailProtocol{
+	"smtp":  {port: "25", banner: smtpBanner, hello: smtpHello, startTLS: smtpStartTLS, quit: "QUIT"},
+	"smtps": {port: "465", implicitTLS: true, banner: smtpBanner, hello: smtpHello, quit: "QUIT"},
+	"imap":  {port: "143", banner: imapBanner, startTLS: imapStartTLS, quit: "Z LOGOUT"},
+	"imaps": {port: "993", implicitTLS: true, banner: imapBanner, quit: "Z LOGOUT"},
+	"pop3":  {port: "110", banner: pop3Banner, startTLS: pop3StartTLS, quit: "QUIT"},
+	"pop3s": {port: "995", implicitTLS: true, banner: pop3Banner, quit: "QUIT"},
+}
+
+// smtpReply reads the reply to a step of an SMTP dialog, which must have the
+// expected code.
+func smtpReply(conn *textproto.Conn, step string, expectCode int) (string, error) {
+	code, msg, err := conn.ReadResponse(expectCode)
+	if _, ok := err.(*textproto.Error); ok {
+		return "", errors.Errorf("%s: unexpected reply \"%d %s\"", step, code, msg)
+	}
+	return msg, errors.Wrap(err, step)
+}
+
+// smtpBanner reads the 220 greeting of an SMTP server.
+func smtpBanner(conn *textproto.Conn) (string, error) {
+	return smtpReply(conn, "banner", 220)
+}
+
+// smtpHello sends EHLO and expects a 250 reply.
+func smtpHello(conn *textproto.Conn, name string) error {
+	if err := conn.PrintfLine("EHLO %s", name); err != nil {
+		return err
+	}
+	_, err := smtpReply(conn, "EHLO", 250)
+	return err
+}
+
+// smtpStartTLS sends STARTTLS and expects a 220 reply.
+func smtpStartTLS(conn *textproto.Conn) error {
+	if err := conn.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	_, err := smtpReply(conn, "STARTTLS", 220)
+	return err
+}
+
+// imapBanner reads the untagged OK or PREAUTH greeting of an IMAP server.
+func imapBanner(conn *textproto.Conn) (string, error) {
+	line, err := conn.ReadLine()
+	if err != nil {
+		return "", errors.Wrap(err, "banner")
+	}
+	if !strings.HasPrefix(line, "* OK") && !strings.HasPrefix(line, "* PREAUTH") {
+		return "", errors.Errorf("banner: unexpected reply %q", line)
+	}
+	return line, nil
+}
+
+// imapStartTLS sends STARTTLS and expects its tagged OK reply.
+func imapStartTLS(conn *textproto.Conn) error {
+	if err := conn.PrintfLine("A STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return errors.Wrap(err, "STARTTLS")
+		}
+		if strings.HasPrefix(line, "* ") {
+			continue
+		}
+		if !strings.HasPrefix(line, "A OK") {
+			return errors.Errorf("STARTTLS: unexpected reply %q", line)
+		}
+		return nil
+	}
+}
+
+// pop3Banner reads the +OK greeting of a POP3 server.
+func pop3Banner(conn *textproto.Conn) (string, error) {
+	line, err := conn.ReadLine()
+	if err != nil {
+		return "", errors.Wrap(err, "banner")
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return "", errors.Errorf("banner: unexpected reply %q", line)
+	}
+	return line, nil
+}
+
+// pop3StartTLS sends STLS and expects a +OK reply.
+func pop3StartTLS(conn *textproto.Conn) error {
+	if err := conn.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	line, err := conn.ReadLine()
+	if err != nil {
+		return errors.Wrap(err, "STLS")
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return errors.Errorf("STLS: unexpected reply %q", line)
+	}
+	return nil
+}
+
+// mailScraper implements the scraper interface for mail server targets.
+type mailScraper struct {
+	*Target
+	proberTLS
+
+	config MailConfig
+	// The compiled BannerRegex of the config, nil without one.
+	bannerRegex *regexp.Regexp
+	// The error compiling the regexp of the config, returned by every
+	// scrape.
+	compileErr error
+
+	// The durations of the phases of the last connection.
+	lastPhases map[string]time.Duration
+}
+
+// newMailScraper creates a scraper of the mail server target with the
+// config, compiling its regexp. TLS connections use the TLS config of the
+// HTTP config.
+func newMailScraper(t *Target, config MailConfig, httpConfig HTTPConfig) *mailScraper {
+	s := &mailScraper{
+		Target: t,
+		config: config,
+	}
+	if config.StartTLS || mailProtocols[t.URL().Scheme].implicitTLS {
+		s.proberTLS = newProberTLS(t, httpConfig)
+	}
+	if config.BannerRegex != "" {
+		if s.bannerRegex, s.compileErr = regexp.Compile(config.BannerRegex); s.compileErr != nil {
+			s.compileErr = errors.Errorf("banner_regex: invalid regexp %q: %s", config.BannerRegex, s.compileErr)
+			log.Println("msg", "Compiling regexps failed", "target", t.URL(), "err", s.compileErr)
+		}
+	}
+	return s
+}
+
+// url returns the target's URL.
+func (s *mailScraper) url() *url.URL {
+	return s.URL()
+}
+
+// labels returns the target's labels.
+func (s *mailScraper) labels() map[string]string {
+	return s.Labels()
+}
+
+// annotate adds the phase durations and certificate chain of the last
+// connection.
+func (s *mailScraper) annotate(resp *TargetResponse) {
+	resp.Phases = s.lastPhases
+	resp.Cert = s.lastCert
+}
+
+// scrape connects to the target, checks its banner and, if configured,
+// greets it and upgrades the connection with STARTTLS.
+func (s *mailScraper) scrape(ctx context.Context) error {
+	s.lastPhases, s.lastCert = nil, nil
+	if s.tlsErr != nil {
+		return s.tlsErr
+	}
+	if s.compileErr != nil {
+		return s.compileErr
+	}
+	proto := mailProtocols[s.URL().Scheme]
+	addr := s.URL().Host
+	if s.URL().Port() == "" {
+		addr = net.JoinHostPort(s.URL().Hostname(), proto.port)
+	}
+
+	phases := map[string]time.Duration{}
+	start := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+	phases[PhaseConnect] = time.Since(start)
+	s.lastPhases = phases
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	if proto.implicitTLS {
+		if conn, err = s.handshake(conn, phases); err != nil {
+			return err
+		}
+	}
+	tp := textproto.NewConn(conn)
+
+	banner, err := proto.banner(tp)
+	if err != nil {
+		return err
+	}
+	if s.bannerRegex != nil && !s.bannerRegex.MatchString(banner) {
+		return errors.Errorf("banner %q did not match regexp %q", banner, s.config.BannerRegex)
+	}
+
+	name := s.config.EHLO
+	if name == "" {
+		name = "localhost"
+	}
+	if proto.hello != nil && (s.config.EHLO != "" || s.config.StartTLS) {
+		if err := proto.hello(tp, name); err != nil {
+			return err
+		}
+	}
+
+	if s.config.StartTLS && proto.startTLS != nil {
+		if err := proto.startTLS(tp); err != nil {
+			return err
+		}
+		if conn, err = s.handshake(conn, phases); err != nil {
+			return err
+		}
+		tp = textproto.NewConn(conn)
+		if proto.hello != nil {
+			if err := proto.hello(tp, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Ending the session is best effort; the probe succeeded regardless.
+	tp.PrintfLine("%s", proto.quit)
+	return nil
+}
+
+// handshake secures the connection with TLS and checks the certificate
+// chain of the server. The connection is returned as is if the handshake
+// failed.
+func (s *mailScraper) handshake(conn net.Conn, phases map[string]time.Duration) (net.Conn, error) {
+	start := time.Now()
+	tlsConn, cert, err := tlsHandshake(conn, s.tlsConfig, s.URL().Hostname(), s.certExpiryWindow)
+	if tlsConn == nil {
+		return conn, err
+	}
+	phases[PhaseTLS] = time.Since(start)
+	s.lastCert = cert
+	return tlsConn, err
+}
@@ -0,0 +1,248 @@
+package scraper
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testMailTLSConfig returns the TLS config of a test server, which provides
+// a certificate for example.com.
+func testMailTLSConfig() *tls.Config {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.StartTLS()
+	server.Close()
+	return server.TLS
+}
+
+// serveMail serves a minimal dialog of the mail protocol of the scheme on
+// the listener, greeting with the banner. STARTTLS is offered if tlsConfig
+// is set.
+func serveMail(l net.Listener, scheme, banner string, tlsConfig *tls.Config) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer func() { conn.Close() }()
+			fmt.Fprintf(conn, "%s\r\n", banner)
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				switch cmd := strings.TrimSpace(line); {
+				case strings.HasPrefix(cmd, "EHLO "):
+					fmt.Fprintf(conn, "250-mail.example.com greets %s\r\n", strings.TrimPrefix(cmd, "EHLO "))
+					if tlsConfig != nil {
+						conn.Write([]byte("250-STARTTLS\r\n"))
+					}
+					conn.Write([]byte("250 8BITMIME\r\n"))
+				case tlsConfig != nil && (cmd == "STARTTLS" || cmd == "A STARTTLS" || cmd == "STLS"):
+					switch scheme {
+					case "smtp":
+						conn.Write([]byte("220 Ready to start TLS\r\n"))
+					case "imap":
+						conn.Write([]byte("A OK Begin TLS negotiation now\r\n"))
+					case "pop3":
+						conn.Write([]byte("+OK Begin TLS negotiation\r\n"))
+					}
+					tlsConn := tls.Server(conn, tlsConfig)
+					if tlsConn.Handshake() != nil {
+						return
+					}
+					conn, r = tlsConn, bufio.NewReader(tlsConn)
+				case cmd == "QUIT" || cmd == "Z LOGOUT":
+					return
+				default:
+					switch scheme {
+					case "smtp":
+						conn.Write([]byte("502 Command not implemented\r\n"))
+					case "imap":
+						conn.Write([]byte("A BAD Unknown command\r\n"))
+					case "pop3":
+						conn.Write([]byte("-ERR Unknown command\r\n"))
+					}
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestMailScraperScrape(t *testing.T) {
+	serverTLS := testMailTLSConfig()
+
+	for _, c := range []struct {
+		name      string
+		scheme    string
+		banner    string
+		tlsConfig *tls.Config
+		config    MailConfig
+		phases    []string
+		err       string
+	}{
+		{
+			name:   "smtp banner",
+			scheme: "smtp",
+			banner: "220 mail.example.com ESMTP Postfix",
+			config: MailConfig{BannerRegex: "ESMTP Postfix$"},
+			phases: []string{PhaseConnect},
+		},
+		{
+			name:   "smtp ehlo",
+			scheme: "smtp",
+			banner: "220 mail.example.com ESMTP",
+			config: MailConfig{EHLO: "probe.example.com"},
+			phases: []string{PhaseConnect},
+		},
+		{
+			name:      "smtp starttls",
+			scheme:    "smtp",
+			banner:    "220 mail.example.com ESMTP",
+			tlsConfig: serverTLS,
+			config:    MailConfig{StartTLS: true},
+			phases:    []string{PhaseConnect, PhaseTLS},
+		},
+		{
+			name:   "smtp unavailable",
+			scheme: "smtp",
+			banner: "554 No SMTP service here",
+			phases: []string{PhaseConnect},
+			err:    `banner: unexpected reply "554 No SMTP service here"`,
+		},
+		{
+			name:   "smtp banner mismatch",
+			scheme: "smtp",
+			banner: "220 mail.example.com ESMTP Exim",
+			config: MailConfig{BannerRegex: "Postfix"},
+			phases: []string{PhaseConnect},
+			err:    `banner "mail.example.com ESMTP Exim" did not match regexp "Postfix"`,
+		},
+		{
+			name:   "smtp starttls unsupported",
+			scheme: "smtp",
+			banner: "220 mail.example.com ESMTP",
+			config: MailConfig{StartTLS: true},
+			phases: []string{PhaseConnect},
+			err:    `STARTTLS: unexpected reply "502 Command not implemented"`,
+		},
+		{
+			name:   "imap banner",
+			scheme: "imap",
+			banner: "* OK [CAPABILITY IMAP4rev1 STARTTLS] Dovecot ready.",
+			config: MailConfig{BannerRegex: "Dovecot"},
+			phases: []string{PhaseConnect},
+		},
+		{
+			name:      "imap starttls",
+			scheme:    "imap",
+			banner:    "* OK [CAPABILITY IMAP4rev1 STARTTLS] Dovecot ready.",
+			tlsConfig: serverTLS,
+			config:    MailConfig{StartTLS: true},
+			phases:    []string{PhaseConnect, PhaseTLS},
+		},
+		{
+			name:   "imap unavailable",
+			scheme: "imap",
+			banner: "* BYE Too many connections",
+			phases: []string{PhaseConnect},
+			err:    `banner: unexpected reply "* BYE Too many connections"`,
+		},
+		{
+			name:   "imap starttls unsupported",
+			scheme: "imap",
+			banner: "* OK Dovecot ready.",
+			config: MailConfig{StartTLS: true},
+			phases: []string{PhaseConnect},
+			err:    `STARTTLS: unexpected reply "A BAD Unknown command"`,
+		},
+		{
+			name:      "pop3 starttls",
+			scheme:    "pop3",
+			banner:    "+OK Dovecot ready.",
+			tlsConfig: serverTLS,
+			config:    MailConfig{StartTLS: true},
+			phases:    []string{PhaseConnect, PhaseTLS},
+		},
+		{
+			name:   "pop3 unavailable",
+			scheme: "pop3",
+			banner: "-ERR Service unavailable",
+			phases: []string{PhaseConnect},
+			err:    `banner: unexpected reply "-ERR Service unavailable"`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer l.Close()
+			go serveMail(l, c.scheme, c.banner, c.tlsConfig)
+
+			targetURL, _ := url.Parse(c.scheme + "://" + l.Addr().String())
+			ms := newMailScraper(NewTarget(targetURL), c.config, HTTPConfig{})
+			ms.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err = ms.scrape(ctx)
+			if c.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.err)
+			}
+
+			var resp TargetResponse
+			ms.annotate(&resp)
+			require.Len(t, resp.Phases, len(c.phases))
+			for _, phase := range c.phases {
+				require.Contains(t, resp.Phases, phase)
+			}
+			if c.tlsConfig != nil {
+				require.NotNil(t, resp.Cert)
+				require.Contains(t, resp.Cert.SANs, "example.com")
+			}
+		})
+	}
+}
+
+func TestMailScraperScrapeImplicitTLS(t *testing.T) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", testMailTLSConfig())
+	require.NoError(t, err)
+	defer l.Close()
+	go serveMail(l, "smtp", "220 mail.example.com ESMTP", nil)
+
+	targetURL, _ := url.Parse("smtps://" + l.Addr().String())
+	ms := newMailScraper(NewTarget(targetURL), MailConfig{EHLO: "probe.example.com"}, HTTPConfig{})
+	ms.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	require.NoError(t, ms.scrape(context.Background()))
+
+	var resp TargetResponse
+	ms.annotate(&resp)
+	require.Contains(t, resp.Phases, PhaseTLS)
+	require.NotNil(t, resp.Cert)
+
+	ms.certExpiryWindow = 100 * 365 * 24 * time.Hour
+	err = ms.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expires")
+
+	// The certificate of the test server is not trusted by default.
+	ms.certExpiryWindow = 0
+	ms.tlsConfig = &tls.Config{}
+	err = ms.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "TLS handshake")
+}
@@ -0,0 +1,178 @@
+package scraper
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Manager maintains a scrape pool for every job of a Config and registers
+// their exporters with a prometheus registerer. The targets of every pool
+// are provided by the service discovery configs of its job.
+type Manager struct {
+	mtx         sync.Mutex
+	registerer  prometheus.Registerer
+	pools       map[string]*ScrapePool
+	configs     map[string]*ScrapeConfig
+	discoveries map[string]*discoveryRun
+}
+
+// discoveryRun is the running discovery of a job.
+type discoveryRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewManager creates a manager registering its pools with the given
+// registerer. The default prometheus registerer is used if it is nil.
+func NewManager(reg prometheus.Registerer) *Manager {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	return &Manager{
+		registerer:  reg,
+		pools:       map[string]*ScrapePool{},
+		configs:     map[string]*ScrapeConfig{},
+		discoveries: map[string]*discoveryRun{},
+	}
+}
+
+// ApplyConfig applies the difference to the previously applied config: pools
+// are started for new jobs and stopped for removed ones. Pools of jobs whose
+// settings changed are reloaded and the discovery of every changed job is
+// restarted. If an error is returned, the running pools are left untouched.
+func (m *Manager) ApplyConfig(cfg *Config) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var (
+		configs = make(map[string]*ScrapeConfig, len(cfg.ScrapeConfigs))
+		created = map[string]*ScrapePool{}
+	)
+	for _, sc := range cfg.ScrapeConfigs {
+		configs[sc.JobName] = sc
+
+		if _, ok := m.pools[sc.JobName]; ok {
+			continue
+		}
+		sp, err := NewScrapePool(sc)
+		if err != nil {
+			return errors.Wrapf(err, "creating scrape pool for job %q", sc.JobName)
+		}
+		created[sc.JobName] = sp
+	}
+
+	for name, sp := range created {
+		if err := m.registerer.Register(sp); err != nil {
+			for _, sp := range created {
+				m.registerer.Unregister(sp)
+			}
+			return errors.Wrapf(err, "registering exporter for job %q", name)
+		}
+	}
+
+	// Nothing can fail from here on.
+	for name, sp := range m.pools {
+		sc, ok := configs[name]
+		if !ok {
+			m.stopPool(name)
+			continue
+		}
+		old := m.configs[name]
+		if reflect.DeepEqual(old, sc) {
+			continue
+		}
+
+		m.stopDiscovery(name)
+		if !sameSettings(old, sc) {
+			sp.reload(sc)
+		}
+		m.configs[name] = sc
+		m.startDiscovery(name, sp, sc)
+	}
+
+	for name, sp := range created {
+		m.pools[name] = sp
+		m.configs[name] = configs[name]
+		sp.Start(nil)
+		m.startDiscovery(name, sp, configs[name])
+	}
+	return nil
+}
+
+// sameSettings reports whether the scrape configs only differ in the sources
+// of their targets.
+func sameSettings(a, b *ScrapeConfig) bool {
+	ac, bc := *a, *b
+	ac.ServiceDiscoveryConfig, bc.ServiceDiscoveryConfig = ServiceDiscoveryConfig{}, ServiceDiscoveryConfig{}
+	return reflect.DeepEqual(ac, bc)
+}
+
+// startDiscovery starts syncing the targets discovered for a job into its
+// pool.
+func (m *Manager) startDiscovery(name string, sp *ScrapePool, sc *ScrapeConfig) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &discoveryRun{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	m.discoveries[name] = d
+
+	go func() {
+		defer close(d.done)
+		sp.RunDiscovery(ctx, sc.discoverers(sp.httpSDFailures)...)
+	}()
+}
+
+// stopDiscovery stops the discovery of a job and waits for it to return.
+func (m *Manager) stopDiscovery(name string) {
+	d, ok := m.discoveries[name]
+	if !ok {
+		return
+	}
+	d.cancel()
+	<-d.done
+	delete(m.discoveries, name)
+}
+
+// stopPool stops and unregisters the pool of a job.
+func (m *Manager) stopPool(name string) {
+	m.stopDiscovery(name)
+
+	sp := m.pools[name]
+	sp.Stop()
+	m.registerer.Unregister(sp)
+
+	delete(m.pools, name)
+	delete(m.configs, name)
+}
+
+// ScrapePools returns the running scrape pools by job name.
+func (m *Manager) ScrapePools() map[string]*ScrapePool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	pools := make(map[string]*ScrapePool, len(m.pools))
+	for name, sp := range m.pools {
+		pools[name] = sp
+	}
+	return pools
+}
+
+// Stop stops all scrape pools.
+func (m *Manager) Stop() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.stopPools()
+}
+
+// stopPools stops and unregisters all running pools.
+func (m *Manager) stopPools() {
+	for name := range m.pools {
+		m.stopPool(name)
+	}
+}
@@ -0,0 +1,245 @@
+package scraper
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// requireActiveTargets waits for the discovery to sync n targets into the pool.
+func requireActiveTargets(t *testing.T, sp *ScrapePool, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return len(sp.ActiveTargets()) == n
+	}, 5*time.Second, 10*time.Millisecond, "expected %d active targets", n)
+}
+
+func TestManagerApplyConfig(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodHead {
+				t.Errorf("Expected method %q, got %q", http.MethodHead, r.Method)
+			}
+		}),
+	)
+	defer server.Close()
+
+	cfg, err := Load([]byte(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 100ms
+    method: HEAD
+    static_configs:
+      - targets: ["` + server.URL + `"]
+  - job_name: api
+    scrape_interval: 100ms
+`))
+	require.NoError(t, err)
+
+	reg := prometheus.NewRegistry()
+	m := NewManager(reg)
+	require.NoError(t, m.ApplyConfig(cfg))
+	defer m.Stop()
+
+	pools := m.ScrapePools()
+	require.Equal(t, 2, len(pools))
+	requireActiveTargets(t, pools["web"], 1)
+	requireActiveTargets(t, pools["api"], 0)
+
+	require.Eventually(t, func() bool {
+		mfs, err := reg.Gather()
+		if err != nil {
+			return false
+		}
+		for _, mf := range mfs {
+			if mf.GetName() != "sample_external_url_up" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "job" && l.GetValue() == "web" {
+						return m.GetGauge().GetValue() == float64(HealthGood)
+					}
+				}
+			}
+		}
+		return false
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Applying a config again replaces the pools.
+	cfg, err = Load([]byte(`
+scrape_configs:
+  - job_name: api
+    scrape_interval: 100ms
+`))
+	require.NoError(t, err)
+	require.NoError(t, m.ApplyConfig(cfg))
+	require.Equal(t, 1, len(m.ScrapePools()))
+}
+
+func TestManagerApplyConfigDiff(t *testing.T) {
+	cfg, err := Load([]byte(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 1h
+    static_configs:
+      - targets: ["http://foo.com", "http://bar.com"]
+  - job_name: api
+    scrape_interval: 1h
+    static_configs:
+      - targets: ["http://baz.com"]
+  - job_name: old
+    scrape_interval: 1h
+`))
+	require.NoError(t, err)
+
+	m := NewManager(prometheus.NewRegistry())
+	require.NoError(t, m.ApplyConfig(cfg))
+	defer m.Stop()
+
+	before := m.ScrapePools()
+
+	cfg, err = Load([]byte(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 1h
+    static_configs:
+      - targets: ["http://foo.com"]
+  - job_name: api
+    scrape_interval: 30m
+    static_configs:
+      - targets: ["http://baz.com"]
+  - job_name: new
+    scrape_interval: 1h
+`))
+	require.NoError(t, err)
+	require.NoError(t, m.ApplyConfig(cfg))
+
+	after := m.ScrapePools()
+	require.Equal(t, 3, len(after))
+	require.NotContains(t, after, "old")
+	require.Contains(t, after, "new")
+
+	// Pools of existing jobs are kept and only updated.
+	require.True(t, before["web"] == after["web"], "pool of unchanged job should be kept")
+	requireActiveTargets(t, after["web"], 1)
+
+	require.True(t, before["api"] == after["api"], "pool of changed job should be kept")
+	require.Equal(t, 30*time.Minute, after["api"].config.ScrapeInterval)
+	requireActiveTargets(t, after["api"], 1)
+}
+
+func TestManagerApplyConfigStoreSize(t *testing.T) {
+	cfg, err := Load([]byte(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 1h
+    store_size: 5
+`))
+	require.NoError(t, err)
+
+	m := NewManager(prometheus.NewRegistry())
+	require.NoError(t, m.ApplyConfig(cfg))
+	defer m.Stop()
+
+	cfg, err = Load([]byte(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 1h
+    store_size: 20
+`))
+	require.NoError(t, err)
+	require.NoError(t, m.ApplyConfig(cfg))
+
+	store := m.ScrapePools()["web"].store.(*Storage)
+	store.Commit()
+	require.Equal(t, 20, cap(store.Commit()))
+}
+
+func TestSameSettings(t *testing.T) {
+	maxLoss, sameMaxLoss := 0.5, 0.5
+	a := &ScrapeConfig{
+		JobName:        "web",
+		ScrapeInterval: time.Minute,
+		PingConfig:     PingConfig{MaxLoss: &maxLoss},
+		ServiceDiscoveryConfig: ServiceDiscoveryConfig{
+			StaticConfigs: []*TargetGroup{{Targets: []string{"http://foo.com"}}},
+		},
+	}
+
+	b := *a
+	b.PingConfig.MaxLoss = &sameMaxLoss
+	b.ServiceDiscoveryConfig = ServiceDiscoveryConfig{}
+	require.True(t, sameSettings(a, &b))
+
+	b.StoreSize = 20
+	require.False(t, sameSettings(a, &b))
+}
+
+func TestManagerApplyConfigRegisterError(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewManager(reg)
+
+	cfg, err := Load([]byte(`
+scrape_configs:
+  - job_name: web
+    static_configs:
+      - targets: ["http://foo.com"]
+`))
+	require.NoError(t, err)
+	require.NoError(t, m.ApplyConfig(cfg))
+	defer m.Stop()
+
+	// A colliding collector makes registering the new job fail.
+	require.NoError(t, reg.Register(newMetrics(prometheus.Labels{"job": "api"}).TargetURLStatus))
+
+	cfg, err = Load([]byte(`
+scrape_configs:
+  - job_name: api
+    static_configs:
+      - targets: ["http://bar.com"]
+`))
+	require.NoError(t, err)
+	require.Error(t, m.ApplyConfig(cfg))
+
+	pools := m.ScrapePools()
+	require.Equal(t, 1, len(pools))
+	require.Contains(t, pools, "web")
+}
+
+func TestManagerFileSD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "targets.json")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`[{"targets": ["foo.com", "bar.com"]}]`), 0644))
+
+	cfg, err := Load([]byte(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 1h
+    file_sd_configs:
+      - files: ["` + filepath.Join(dir, "*.json") + `"]
+        refresh_interval: 50ms
+`))
+	require.NoError(t, err)
+
+	m := NewManager(prometheus.NewRegistry())
+	require.NoError(t, m.ApplyConfig(cfg))
+	defer m.Stop()
+
+	sp := m.ScrapePools()["web"]
+	requireActiveTargets(t, sp, 2)
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`[{"targets": ["foo.com"]}]`), 0644))
+	requireActiveTargets(t, sp, 1)
+	require.Equal(t, []string{"http://foo.com"}, activeURLs(sp))
+}
@@ -0,0 +1,318 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of the probes of ping:// targets.
+const (
+	defaultPingCount        = 5
+	defaultPingInterval     = 100 * time.Millisecond
+	defaultPingProbeTimeout = time.Second
+	defaultPingPacketSize   = 16
+)
+
+// pingMagic starts the payload of UDP probes.
+var pingMagic = []byte("PING")
+
+// PingConfig configures the probes of ping:// targets, which sample the
+// reachability and latency of a port with several small probes per scrape.
+// Unlike ICMP, the probes need no privileges.
+type PingConfig struct {
+	// The protocol of the probes: tcp connects to the port, udp sends
+	// datagrams to be echoed by it. Defaults to tcp.
+	Protocol string `yaml:"protocol"`
+	// The number of probes per scrape. Defaults to 5.
+	Count int `yaml:"count"`
+	// The time between the start of two probes. Defaults to 100ms.
+	Interval time.Duration `yaml:"interval"`
+	// The time after which a probe is lost. Defaults to 1s.
+	ProbeTimeout time.Duration `yaml:"probe_timeout"`
+	// The size of the payload of UDP probes in bytes. Defaults to 16.
+	PacketSize int `yaml:"packet_size"`
+	// The ratio of lost probes above which scrapes fail. Scrapes fail if
+	// every probe is lost by default.
+	MaxLoss *float64 `yaml:"max_loss"`
+}
+
+// validate checks the config.
+func (c *PingConfig) validate(pos position) error {
+	switch c.Protocol {
+	case "", "tcp", "udp":
+	default:
+		return pos.key("protocol").errorf("unsupported ping protocol %q", c.Protocol)
+	}
+	if c.Count < 0 {
+		return pos.key("count").errorf("count must not be negative")
+	}
+	if c.Interval < 0 {
+		return pos.key("interval").errorf("interval must not be negative")
+	}
+	if c.ProbeTimeout < 0 {
+		return pos.key("probe_timeout").errorf("probe_timeout must not be negative")
+	}
+	if c.PacketSize != 0 && c.PacketSize < len(pingMagic)+4 {
+		return pos.key("packet_size").errorf("packet_size must be at least %d bytes", len(pingMagic)+4)
+	}
+	if c.MaxLoss != nil && (*c.MaxLoss < 0 || *c.MaxLoss > 1) {
+		return pos.key("max_loss").errorf("max_loss %g must be between 0 and 1", *c.MaxLoss)
+	}
+	return nil
+}
+
+// duration returns the longest time the probes of a scrape take: the last
+// probe is sent count-1 intervals after the first and is lost after the
+// probe timeout.
+func (c *PingConfig) duration() time.Duration {
+	count, interval, timeout := c.Count, c.Interval, c.ProbeTimeout
+	if count == 0 {
+		count = defaultPingCount
+	}
+	if interval == 0 {
+		interval = defaultPingInterval
+	}
+	if timeout == 0 {
+		timeout = defaultPingProbeTimeout
+	}
+	return time.Duration(count-1)*interval + timeout
+}
+
+// PingStats are the statistics of the probes of a scrape of a ping:// target.
+// The round trip times are those of the probes which got a reply.
+type PingStats struct {
+	Sent     int `json:"sent"`
+	Received int `json:"received"`
+
+	Min time.Duration `json:"min"`
+	Avg time.Duration `json:"avg"`
+	Max time.Duration `json:"max"`
+	// The mean difference between the round trip times of consecutive
+	// replies.
+	Jitter time.Duration `json:"jitter"`
+}
+
+// LossRatio returns the ratio of the probes which got no reply.
+func (s *PingStats) LossRatio() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) / float64(s.Sent)
+}
+
+// pingStats computes the statistics of the given number of probes which got
+// replies with the given round trip times, in order.
+func pingStats(sent int, rtts []time.Duration) *PingStats {
+	stats := &PingStats{Sent: sent, Received: len(rtts)}
+	if len(rtts) == 0 {
+		return stats
+	}
+	var sum, diffs time.Duration
+	stats.Min, stats.Max = rtts[0], rtts[0]
+	for i, rtt := range rtts {
+		sum += rtt
+		if rtt < stats.Min {
+			stats.Min = rtt
+		}
+		if rtt > stats.Max {
+			stats.Max = rtt
+		}
+		if i > 0 {
+			diff := rtt - rtts[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			diffs += diff
+		}
+	}
+	stats.Avg = sum / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		stats.Jitter = diffs / time.Duration(len(rtts)-1)
+	}
+	return stats
+}
+
+// pingScraper implements the scraper interface for ping:// targets.
+type pingScraper struct {
+	*Target
+
+	config PingConfig
+
+	// The statistics of the probes of the last scrape.
+	lastStats *PingStats
+}
+
+// newPingScraper creates a scraper of the ping:// target with the config.
+func newPingScraper(t *Target, config PingConfig) *pingScraper {
+	return &pingScraper{
+		Target: t,
+		config: config,
+	}
+}
+
+// url returns the target's URL.
+func (s *pingScraper) url() *url.URL {
+	return s.URL()
+}
+
+// labels returns the target's labels.
+func (s *pingScraper) labels() map[string]string {
+	return s.Labels()
+}
+
+// annotate adds the statistics of the probes of the last scrape.
+func (s *pingScraper) annotate(resp *TargetResponse) {
+	resp.Ping = s.lastStats
+}
+
+// scrape sends the probes to the target, spaced by the interval of the
+// config. Probes are no longer sent once the context is done. The scrape
+// fails if too many probes are lost.
+func (s *pingScraper) scrape(ctx context.Context) error {
+	s.lastStats = nil
+
+	count, interval := s.config.Count, s.config.Interval
+	if count == 0 {
+		count = defaultPingCount
+	}
+	if interval == 0 {
+		interval = defaultPingInterval
+	}
+
+	probe := s.probeTCP
+	if s.config.Protocol == "udp" {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "udp", s.URL().Host)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		probe = func(ctx context.Context, seq int) (time.Duration, error) {
+			return s.probeUDP(ctx, conn, seq)
+		}
+	}
+
+	var (
+		sent    int
+		rtts    []time.Duration
+		lastErr error
+	)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		sent++
+		rtt, err := probe(ctx, seq)
+		if err != nil {
+			// A probe cut short by the end of the scrape isn't lost.
+			if scrapeEnded(ctx) {
+				sent--
+				break
+			}
+			lastErr = err
+			continue
+		}
+		rtts = append(rtts, rtt)
+	}
+	s.lastStats = pingStats(sent, rtts)
+
+	switch {
+	case sent == 0:
+		err := ctx.Err()
+		if err == nil {
+			// The deadline passed, but the context isn't done yet.
+			err = context.DeadlineExceeded
+		}
+		return errors.Wrap(err, "no probes sent")
+	case len(rtts) == 0:
+		return errors.Wrapf(lastErr, "all %d probes lost", sent)
+	case s.config.MaxLoss != nil && s.lastStats.LossRatio() > *s.config.MaxLoss:
+		return errors.Wrapf(lastErr, "lost %d of %d probes", sent-len(rtts), sent)
+	}
+	return nil
+}
+
+// scrapeEnded reports whether the context of the scrape is done or past its
+// deadline. Deadlines of connections may pass before the context is done.
+func scrapeEnded(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// probeContext returns the context of a single probe, which ends after the
+// probe timeout.
+func (s *pingScraper) probeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := s.config.ProbeTimeout
+	if timeout == 0 {
+		timeout = defaultPingProbeTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// probeTCP returns the time it takes to connect to the target.
+func (s *pingScraper) probeTCP(ctx context.Context, seq int) (time.Duration, error) {
+	ctx, cancel := s.probeContext(ctx)
+	defer cancel()
+
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", s.URL().Host)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	conn.Close()
+	return rtt, nil
+}
+
+// probeUDP sends a datagram carrying the sequence number of the probe and
+// returns the time until it is echoed. Late replies to earlier probes are
+// skipped.
+func (s *pingScraper) probeUDP(ctx context.Context, conn net.Conn, seq int) (time.Duration, error) {
+	ctx, cancel := s.probeContext(ctx)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return 0, err
+		}
+	}
+
+	size := s.config.PacketSize
+	if size == 0 {
+		size = defaultPingPacketSize
+	}
+	payload := make([]byte, size)
+	copy(payload, pingMagic)
+	binary.BigEndian.PutUint32(payload[len(pingMagic):], uint32(seq))
+
+	start := time.Now()
+	if _, err := conn.Write(payload); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, size+1)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(buf[:n], payload) {
+			return time.Since(start), nil
+		}
+	}
+}
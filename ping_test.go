@@ -0,0 +1,153 @@
+package scraper
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// serveUDPEcho echoes the datagrams received on the connection, skipping
+// those for which drop returns true.
+func serveUDPEcho(conn net.PacketConn, drop func(n int) bool) {
+	buf := make([]byte, 1024)
+	for n := 0; ; n++ {
+		size, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if drop != nil && drop(n) {
+			continue
+		}
+		conn.WriteTo(buf[:size], addr)
+	}
+}
+
+func TestPingStats(t *testing.T) {
+	ms := time.Millisecond
+	require.Equal(t, &PingStats{Sent: 3}, pingStats(3, nil))
+	require.Equal(t, &PingStats{Sent: 1, Received: 1, Min: 4 * ms, Avg: 4 * ms, Max: 4 * ms}, pingStats(1, []time.Duration{4 * ms}))
+
+	stats := pingStats(5, []time.Duration{2 * ms, 6 * ms, 4 * ms, 4 * ms})
+	require.Equal(t, &PingStats{Sent: 5, Received: 4, Min: 2 * ms, Avg: 4 * ms, Max: 6 * ms, Jitter: 2 * ms}, stats)
+	require.Equal(t, 0.2, stats.LossRatio())
+}
+
+func TestPingScraperScrapeTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	targetURL, _ := url.Parse("ping://" + l.Addr().String())
+	ps := &pingScraper{
+		Target: NewTarget(targetURL),
+		config: PingConfig{Count: 3, Interval: 5 * time.Millisecond},
+	}
+	require.NoError(t, ps.scrape(context.Background()))
+
+	var resp TargetResponse
+	ps.annotate(&resp)
+	require.NotNil(t, resp.Ping)
+	require.Equal(t, 3, resp.Ping.Sent)
+	require.Equal(t, 3, resp.Ping.Received)
+	require.True(t, resp.Ping.Min > 0 && resp.Ping.Min <= resp.Ping.Avg && resp.Ping.Avg <= resp.Ping.Max)
+
+	// Once the listener is closed, every probe is refused.
+	l.Close()
+	err = ps.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "all 3 probes lost")
+	ps.annotate(&resp)
+	require.Equal(t, &PingStats{Sent: 3}, resp.Ping)
+}
+
+func TestPingScraperScrapeUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	// Every other datagram is lost.
+	go serveUDPEcho(conn, func(n int) bool { return n%2 == 1 })
+
+	targetURL, _ := url.Parse("ping://" + conn.LocalAddr().String())
+	ps := &pingScraper{
+		Target: NewTarget(targetURL),
+		config: PingConfig{
+			Protocol:     "udp",
+			Count:        4,
+			Interval:     5 * time.Millisecond,
+			ProbeTimeout: 50 * time.Millisecond,
+			PacketSize:   64,
+		},
+	}
+	require.NoError(t, ps.scrape(context.Background()))
+
+	var resp TargetResponse
+	ps.annotate(&resp)
+	require.Equal(t, 4, resp.Ping.Sent)
+	require.Equal(t, 2, resp.Ping.Received)
+	require.Equal(t, 0.5, resp.Ping.LossRatio())
+
+	maxLoss := 0.25
+	ps.config.MaxLoss = &maxLoss
+	err = ps.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "lost 2 of 4 probes")
+}
+
+func TestPingScraperScrapeTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveUDPEcho(conn, nil)
+
+	targetURL, _ := url.Parse("ping://" + conn.LocalAddr().String())
+	ps := &pingScraper{
+		Target: NewTarget(targetURL),
+		config: PingConfig{Protocol: "udp", Count: 100, Interval: 30 * time.Millisecond},
+	}
+
+	// No probes are sent after the scrape timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, ps.scrape(ctx))
+
+	var resp TargetResponse
+	ps.annotate(&resp)
+	require.Less(t, resp.Ping.Sent, 100)
+	require.Equal(t, resp.Ping.Sent, resp.Ping.Received)
+}
+
+func TestPingScraperScrapeTimeoutDuringProbe(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	// Only the first datagram is echoed.
+	go serveUDPEcho(conn, func(n int) bool { return n > 0 })
+
+	targetURL, _ := url.Parse("ping://" + conn.LocalAddr().String())
+	ps := &pingScraper{
+		Target: NewTarget(targetURL),
+		config: PingConfig{Protocol: "udp", Count: 3, Interval: 10 * time.Millisecond, ProbeTimeout: time.Second},
+	}
+
+	// The second probe is cut short by the scrape timeout, not lost.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.NoError(t, ps.scrape(ctx))
+
+	var resp TargetResponse
+	ps.annotate(&resp)
+	require.Equal(t, 1, resp.Ping.Sent)
+	require.Equal(t, 1, resp.Ping.Received)
+}
@@ -2,33 +2,82 @@ package scraper
 
 import (
 	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/arriqaaq/boomerang"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/http/httpproxy"
 )
 
 // ScrapeConfig describes the config for the scraper pool.
 type ScrapeConfig struct {
+	// The job name exported as a label on the metrics of this config.
+	JobName string `yaml:"job_name"`
 	// How frequently to scrape the targets of this scrape config.
-	ScrapeInterval time.Duration
+	ScrapeInterval time.Duration `yaml:"scrape_interval"`
 	// The timeout for scraping targets of this config.
-	ScrapeTimeout time.Duration
+	ScrapeTimeout time.Duration `yaml:"scrape_timeout"`
 	// The channel size for the storage.
-	StoreSize int
+	StoreSize int `yaml:"store_size"`
 	// Jitter seed
-	JitterSeed uint64
+	JitterSeed uint64 `yaml:"jitter_seed"`
+
+	// The URL scheme of targets given as host:port, which selects how they
+	// are probed. Defaults to http.
+	Scheme string `yaml:"scheme"`
+	// The URL path of targets given as host:port.
+	Path string `yaml:"path"`
+
+	// The HTTP request settings for the targets of this config.
+	HTTPConfig `yaml:",inline"`
+	// The settings of the probes of tcp:// targets.
+	TCPConfig TCPConfig `yaml:"tcp"`
+	// The settings of the probes of dns:// targets.
+	DNSConfig DNSConfig `yaml:"dns"`
+	// The settings of the probes of grpc:// and grpcs:// targets.
+	GRPCConfig GRPCConfig `yaml:"grpc"`
+	// The settings of the probes of ws:// and wss:// targets.
+	WebSocketConfig WebSocketConfig `yaml:"websocket"`
+	// The settings of the probes of ping:// targets.
+	PingConfig PingConfig `yaml:"ping"`
+	// The settings of the probes of mail server targets.
+	MailConfig MailConfig `yaml:"mail"`
+
+	// Rules applied to the labels of discovered targets before they are
+	// scraped.
+	RelabelConfigs []*RelabelConfig `yaml:"relabel_configs"`
+	// Rules applied to the labels of the exported series.
+	MetricRelabelConfigs []*RelabelConfig `yaml:"metric_relabel_configs"`
+
+	// The sources of the targets of this config.
+	ServiceDiscoveryConfig `yaml:",inline"`
 }
 
 func NewScrapePool(
 	cfg *ScrapeConfig,
 ) (*ScrapePool, error) {
 
-	client := boomerang.NewHttpClient(&boomerang.ClientConfig{
-		Transport:  boomerang.DefaultTransport(),
-		Timeout:    cfg.ScrapeTimeout,
-		MaxRetries: 1,
-	})
+	if err := validateRelabelConfigs(position{}, cfg.RelabelConfigs); err != nil {
+		return nil, errors.Wrap(err, "invalid relabel config")
+	}
+	if err := validateRelabelConfigs(position{}, cfg.MetricRelabelConfigs); err != nil {
+		return nil, errors.Wrap(err, "invalid metric relabel config")
+	}
+
+	if err := cfg.HTTPConfig.validate(position{}); err != nil {
+		return nil, errors.Wrap(err, "invalid HTTP config")
+	}
+
+	client, err := newClient(cfg.HTTPConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating HTTP client")
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	sp := &ScrapePool{
@@ -38,13 +87,27 @@ func NewScrapePool(
 		client: client,
 		loops:  map[uint64]loop{},
 		quitCh: make(chan struct{}, 1),
+
+		activeTargets: map[uint64]*Target{},
 	}
 
 	// store is a common storage to which multiple scrapers will push
 	sp.store = NewStorage(sp.config.StoreSize)
 
 	// Setup prometheus metrics exporter
-	sp.Exporter = NewExporter(NewMetrics(), sp.config.StoreSize)
+	metrics := newMetrics(metricsLabels(cfg))
+	sp.Exporter = NewExporter(metrics, sp.config.StoreSize)
+	sp.Exporter.setMetricRelabelConfigs(cfg.MetricRelabelConfigs)
+
+	sp.httpSDFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace:   "sample",
+			Subsystem:   "sd",
+			Name:        "http_failures_total",
+			Help:        "Number of HTTP service discovery refresh failures",
+			ConstLabels: metricsLabels(cfg),
+		},
+	)
 
 	sp.newLoop = func(opts scrapeLoopOptions) loop {
 
@@ -58,24 +121,115 @@ func NewScrapePool(
 	return sp, nil
 }
 
+// metricsLabels returns the constant labels of the metrics of a config.
+func metricsLabels(cfg *ScrapeConfig) prometheus.Labels {
+	if cfg.JobName == "" {
+		return nil
+	}
+	return prometheus.Labels{"job": cfg.JobName}
+}
+
+// newClient creates the HTTP client used to scrape targets with the given
+// settings. The client has no timeout of its own; every scrape is bounded by
+// the timeout of its target instead.
+func newClient(cfg HTTPConfig) (doer, error) {
+	transport := boomerang.DefaultTransport()
+	if cfg.TLSConfig != (TLSConfig{}) {
+		tlsConfig, err := cfg.TLSConfig.newTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	if proxy := cfg.proxyFunc(); proxy != nil {
+		transport.Proxy = proxy
+	}
+	// The client of net/http is used instead of a boomerang client, which
+	// can't control redirects.
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: cfg.Redirects.checkRedirect,
+	}, nil
+}
+
+// ownClient reports whether the config sets up the client, so that targets
+// with these settings need a client of their own.
+func (c HTTPConfig) ownClient() bool {
+	return c.TLSConfig != (TLSConfig{}) || c.ProxyURL != "" || len(c.NoProxy) > 0 ||
+		c.Redirects.Follow != nil || c.Redirects.MaxHops > 0
+}
+
+// proxyFunc returns the proxy function of a transport for the config, or nil
+// to use the proxy of the environment. Requests to localhost are never
+// proxied.
+func (c HTTPConfig) proxyFunc() func(*http.Request) (*url.URL, error) {
+	if c.ProxyURL == "" && len(c.NoProxy) == 0 {
+		return nil
+	}
+	cfg := httpproxy.FromEnvironment()
+	if c.ProxyURL != "" {
+		cfg.HTTPProxy, cfg.HTTPSProxy = c.ProxyURL, c.ProxyURL
+	}
+	if len(c.NoProxy) > 0 {
+		cfg.NoProxy = strings.Join(c.NoProxy, ",")
+	}
+	proxy := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// redactURL returns the URL with its password redacted, for messages. URLs
+// which can't be parsed are redacted entirely.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redactedSecret
+	}
+	return u.Redacted()
+}
+
 // ScrapePool manages scrapes for sets of targets.
 type ScrapePool struct {
 	mtx    sync.Mutex
 	ctx    context.Context
-	client *boomerang.HttpClient
-	loops  map[uint64]loop
-	config *ScrapeConfig
-	cancel context.CancelFunc
-	store  Store
+	client doer
+	// The error creating the client on reload, if it failed.
+	clientErr error
+	loops     map[uint64]loop
+	config    *ScrapeConfig
+	cancel    context.CancelFunc
+	store     Store
+
+	// Targets of the currently running loops, keyed by the target hash.
+	activeTargets map[uint64]*Target
+	// Ticker for committing the responses to the exporter, set once the
+	// pool is started.
+	ticker *time.Ticker
 
 	*Exporter
 
+	// Number of failed HTTP service discovery refreshes.
+	httpSDFailures prometheus.Counter
+
 	quitCh chan struct{}
 
 	// Constructor for new scrape loops.
 	newLoop func(scrapeLoopOptions) loop
 }
 
+// Describe implements prometheus.Collector.
+func (sp *ScrapePool) Describe(ch chan<- *prometheus.Desc) {
+	sp.Exporter.Describe(ch)
+	sp.httpSDFailures.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (sp *ScrapePool) Collect(ch chan<- prometheus.Metric) {
+	sp.Exporter.Collect(ch)
+	sp.httpSDFailures.Collect(ch)
+}
+
 // Stop terminates all scrape loops and returns after they all terminated.
 func (sp *ScrapePool) Stop() {
 	sp.mtx.Lock()
@@ -94,52 +248,208 @@ func (sp *ScrapePool) Stop() {
 		}(l)
 
 		delete(sp.loops, fp)
+		delete(sp.activeTargets, fp)
 	}
 
 	wg.Wait()
 }
 
-// Start starts scrape loops for new targets.
+// Start starts scrape loops for the given targets and begins committing their
+// responses to the exporter. Use Sync to change the set of targets afterwards.
 func (sp *ScrapePool) Start(targets []*Target) {
+	sp.Sync(targets)
 
-	var (
-		interval = time.Duration(sp.config.ScrapeInterval)
-		timeout  = time.Duration(sp.config.ScrapeTimeout)
-	)
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	if sp.ticker != nil {
+		return
+	}
+	ticker := time.NewTicker(sp.config.ScrapeInterval)
+	sp.ticker = ticker
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// Committing under the lock keeps Sync from deleting the
+				// series of removed targets in between.
+				sp.mtx.Lock()
+				entries := sp.store.Commit()
+				sp.Exporter.setEntries(entries)
+				sp.mtx.Unlock()
+				break
+			case <-sp.quitCh:
+				return
+			}
+		}
+	}()
+}
+
+// Sync starts scrape loops for new targets and stops scrape loops for targets
+// that are no longer present. Loops of targets that are still present are
+// left running.
+func (sp *ScrapePool) Sync(targets []*Target) {
 
 	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	uniqueLoops := make(map[uint64]loop)
 
 	for _, t := range targets {
 		hash := t.hash()
-		ts := &targetScraper{Target: t, client: sp.client, timeout: timeout}
-		newLoop := sp.newLoop(scrapeLoopOptions{
-			target:  t,
-			scraper: ts,
-		})
-		sp.loops[hash] = newLoop
 
+		if _, ok := sp.activeTargets[hash]; !ok {
+			l := sp.newTargetLoop(t)
+
+			sp.activeTargets[hash] = t
+			sp.loops[hash] = l
+
+			uniqueLoops[hash] = l
+		} else {
+			// This might be a duplicated target.
+			if _, ok := uniqueLoops[hash]; !ok {
+				uniqueLoops[hash] = nil
+			}
+		}
 	}
 
-	sp.mtx.Unlock()
+	var (
+		wg      sync.WaitGroup
+		removed []*Target
+	)
+
+	// Stop and remove old targets and scraper loops.
+	for hash, t := range sp.activeTargets {
+		if _, ok := uniqueLoops[hash]; !ok {
+			removed = append(removed, t)
+			wg.Add(1)
+			go func(l loop) {
+				l.stop()
+				wg.Done()
+			}(sp.loops[hash])
 
-	for _, l := range sp.loops {
+			delete(sp.loops, hash)
+			delete(sp.activeTargets, hash)
+		}
+	}
+
+	// Actually start scraping after all the targets are processed.
+	for hash, l := range uniqueLoops {
 		if l != nil {
+			interval, timeout := sp.activeTargets[hash].intervalAndTimeout(sp.config.ScrapeInterval, sp.config.ScrapeTimeout)
 			go l.run(interval, timeout, nil)
 		}
 	}
 
-	ticker := time.NewTicker(interval)
+	wg.Wait()
 
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				entries := sp.store.Commit()
-				sp.Exporter.entries = entries
-				break
-			case <-sp.quitCh:
-				return
-			}
+	// The responses reported by the stopped loops are committed before the
+	// series of their targets are deleted, so that none are exported again.
+	if len(removed) > 0 {
+		sp.Exporter.setEntries(sp.store.Commit())
+		for _, t := range removed {
+			sp.Exporter.deleteTarget(t.URL(), t.Labels())
 		}
-	}()
+	}
+}
+
+// reload stops all scrape loops and restarts them for the same targets with
+// the given config. The exporter, and with it the state of the metrics, is
+// kept.
+func (sp *ScrapePool) reload(cfg *ScrapeConfig) {
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	var wg sync.WaitGroup
+
+	for _, l := range sp.loops {
+		wg.Add(1)
+
+		go func(l loop) {
+			l.stop()
+			wg.Done()
+		}(l)
+	}
+
+	wg.Wait()
+
+	sp.config = cfg
+	// The files of the TLS settings may have vanished since the config was
+	// loaded, which fails the scrapes of the targets until the next reload.
+	sp.client, sp.clientErr = newClient(cfg.HTTPConfig)
+	if sp.clientErr != nil {
+		log.Println("msg", "Creating HTTP client failed", "job", cfg.JobName, "err", sp.clientErr)
+	}
+	sp.Exporter.setMetricRelabelConfigs(cfg.MetricRelabelConfigs)
+	if s, ok := sp.store.(*Storage); ok {
+		s.resize(cfg.StoreSize)
+	}
+
+	for hash, t := range sp.activeTargets {
+		l := sp.newTargetLoop(t)
+		sp.loops[hash] = l
+
+		interval, timeout := t.intervalAndTimeout(cfg.ScrapeInterval, cfg.ScrapeTimeout)
+		go l.run(interval, timeout, nil)
+	}
+
+	if sp.ticker != nil {
+		sp.ticker.Reset(cfg.ScrapeInterval)
+	}
+}
+
+// newTargetLoop creates a scrape loop for the target with the current
+// config of the pool.
+func (sp *ScrapePool) newTargetLoop(t *Target) loop {
+	return sp.newLoop(scrapeLoopOptions{
+		target:  t,
+		scraper: sp.newScraper(t),
+	})
+}
+
+// newScraper creates the scraper of a target, which depends on the scheme
+// of its URL.
+func (sp *ScrapePool) newScraper(t *Target) scraper {
+	httpConfig := sp.config.HTTPConfig.merge(t.options.HTTPConfig)
+
+	switch t.URL().Scheme {
+	case "tcp":
+		return newTCPScraper(t, sp.config.TCPConfig.merge(t.options.TCP), httpConfig)
+	case "dns":
+		return newDNSScraper(t, sp.config.DNSConfig)
+	case "grpc", "grpcs":
+		return newGRPCScraper(t, sp.config.GRPCConfig, httpConfig)
+	case "ws", "wss":
+		return newWebSocketScraper(t, sp.config.WebSocketConfig, httpConfig)
+	case "ping":
+		return newPingScraper(t, sp.config.PingConfig)
+	case "smtp", "smtps", "imap", "imaps", "pop3", "pop3s":
+		return newMailScraper(t, sp.config.MailConfig, httpConfig)
+	}
+
+	ts := newTargetScraper(t, httpConfig)
+	ts.client, ts.clientErr = sp.client, sp.clientErr
+	_, ts.timeout = t.intervalAndTimeout(sp.config.ScrapeInterval, sp.config.ScrapeTimeout)
+	// Targets with client settings of their own get a client of their own.
+	if t.options.ownClient() {
+		ts.client, ts.clientErr = newClient(ts.httpConfig)
+		if ts.clientErr != nil {
+			log.Println("msg", "Creating HTTP client failed", "target", t.URL(), "err", ts.clientErr)
+		}
+	}
+	return ts
+}
+
+// ActiveTargets returns the targets currently being scraped.
+func (sp *ScrapePool) ActiveTargets() []*Target {
+	sp.mtx.Lock()
+	defer sp.mtx.Unlock()
+
+	tActive := make([]*Target, 0, len(sp.activeTargets))
+	for _, t := range sp.activeTargets {
+		tActive = append(tActive, t)
+	}
+	return tActive
 }
@@ -1,12 +1,17 @@
 package scraper
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/arriqaaq/boomerang"
+	"github.com/prometheus/client_golang/prometheus"
+	model "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -73,3 +78,271 @@ func TestScrapePoolScrapeLoopsStarted(t *testing.T) {
 		require.True(t, l.(*testLoop).runOnce, "loop should be running")
 	}
 }
+
+func TestNewScrapePoolInvalidHTTPConfig(t *testing.T) {
+	_, err := NewScrapePool(&ScrapeConfig{
+		ScrapeInterval: time.Minute,
+		ScrapeTimeout:  10 * time.Second,
+		HTTPConfig: HTTPConfig{
+			BodyAssertions: BodyAssertions{MustMatch: []string{"("}},
+		},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid regexp "("`)
+}
+
+func TestScrapePoolSync(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		started = map[string]int{}
+		stopped = map[string]int{}
+	)
+	newLoop := func(opts scrapeLoopOptions) loop {
+		u := opts.target.URL().String()
+		l := &testLoop{
+			startFunc: func(interval, timeout time.Duration, errc chan<- error) {
+				mtx.Lock()
+				started[u]++
+				mtx.Unlock()
+			},
+			stopFunc: func() {
+				mtx.Lock()
+				stopped[u]++
+				mtx.Unlock()
+			},
+		}
+		return l
+	}
+	sp, err := NewScrapePool(&ScrapeConfig{
+		ScrapeInterval: time.Duration(3 * time.Second),
+		ScrapeTimeout:  time.Duration(2 * time.Second),
+	})
+	require.NoError(t, err)
+	sp.newLoop = newLoop
+
+	newTarget := func(u string) *Target {
+		serverURL, _ := url.Parse(u)
+		return NewTarget(serverURL)
+	}
+
+	sp.Sync([]*Target{newTarget("http://foo.com"), newTarget("http://bar.com"), newTarget("http://bar.com")})
+	require.Equal(t, 2, len(sp.loops))
+	require.Equal(t, 2, len(sp.ActiveTargets()))
+
+	sp.Sync([]*Target{newTarget("http://bar.com"), newTarget("http://baz.com")})
+	require.Equal(t, 2, len(sp.loops))
+
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return started["http://foo.com"] == 1 && started["http://bar.com"] == 1 && started["http://baz.com"] == 1
+	}, 5*time.Second, 10*time.Millisecond, "new loops should be started exactly once")
+
+	mtx.Lock()
+	require.Equal(t, 1, stopped["http://foo.com"], "vanished target's loop should be stopped")
+	require.Equal(t, 0, stopped["http://bar.com"], "unchanged target's loop should keep running")
+	mtx.Unlock()
+
+	sp.Stop()
+	require.Equal(t, 0, len(sp.loops))
+	require.Equal(t, 0, len(sp.ActiveTargets()))
+}
+
+func TestScrapePoolSyncDeletesSeries(t *testing.T) {
+	sp, err := NewScrapePool(&ScrapeConfig{
+		JobName:        "web",
+		ScrapeInterval: 15 * time.Second,
+		ScrapeTimeout:  10 * time.Second,
+	})
+	require.NoError(t, err)
+	sp.newLoop = func(opts scrapeLoopOptions) loop {
+		return &testLoop{
+			startFunc: func(interval, timeout time.Duration, errc chan<- error) {},
+			stopFunc:  func() {},
+		}
+	}
+
+	fooURL, _ := url.Parse("https://foo.com")
+	barURL, _ := url.Parse("https://bar.com")
+	foo := NewTargetWithLabels(fooURL, map[string]string{"env": "prod"})
+	bar := NewTarget(barURL)
+	sp.Sync([]*Target{foo, bar})
+
+	report := func(tgt *Target) {
+		require.NoError(t, sp.store.Append(TargetResponse{
+			URL:        tgt.URL(),
+			Labels:     tgt.Labels(),
+			Status:     HealthBad,
+			StatusCode: 500,
+			FinalURL:   tgt.URL().String(),
+		}))
+	}
+	report(foo)
+	report(bar)
+	sp.Exporter.setEntries(sp.store.Commit())
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(sp))
+	_, err = reg.Gather()
+	require.NoError(t, err)
+
+	// A response reported before the loop stopped isn't exported either.
+	report(foo)
+	sp.Sync([]*Target{bar})
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			require.NotEqual(t, "https://foo.com", labels2Map(m.GetLabel())["url"], mf.GetName())
+		}
+	}
+	var up *model.MetricFamily
+	for _, mf := range mfs {
+		if mf.GetName() == urlUpMetricName {
+			up = mf
+		}
+	}
+	require.NotNil(t, up)
+	require.Len(t, up.GetMetric(), 1)
+	require.Equal(t, "https://bar.com", labels2Map(up.GetMetric()[0].GetLabel())["url"])
+}
+
+func TestScrapePoolSyncTargetIntervals(t *testing.T) {
+	type settings struct {
+		interval, timeout time.Duration
+	}
+	var (
+		mtx     sync.Mutex
+		started = map[string]settings{}
+	)
+	sp, err := NewScrapePool(&ScrapeConfig{
+		ScrapeInterval: 15 * time.Second,
+		ScrapeTimeout:  10 * time.Second,
+	})
+	require.NoError(t, err)
+	sp.newLoop = func(opts scrapeLoopOptions) loop {
+		u := opts.target.URL().String()
+		return &testLoop{
+			startFunc: func(interval, timeout time.Duration, errc chan<- error) {
+				mtx.Lock()
+				started[u] = settings{interval, timeout}
+				mtx.Unlock()
+			},
+			stopFunc: func() {},
+		}
+	}
+
+	critical, _ := url.Parse("http://critical.com")
+	batch, _ := url.Parse("http://batch.com")
+	plain, _ := url.Parse("http://plain.com")
+	sp.Sync([]*Target{
+		NewTargetWithOptions(critical, nil, TargetOptions{ScrapeInterval: 5 * time.Second}),
+		NewTargetWithOptions(batch, nil, TargetOptions{ScrapeInterval: 5 * time.Minute, ScrapeTimeout: time.Minute}),
+		NewTarget(plain),
+	})
+
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(started) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.Equal(t, settings{5 * time.Second, 5 * time.Second}, started["http://critical.com"])
+	require.Equal(t, settings{5 * time.Minute, time.Minute}, started["http://batch.com"])
+	require.Equal(t, settings{15 * time.Second, 10 * time.Second}, started["http://plain.com"])
+}
+
+func TestScrapePoolTargetClients(t *testing.T) {
+	sp, err := NewScrapePool(&ScrapeConfig{
+		ScrapeInterval: 15 * time.Second,
+		ScrapeTimeout:  10 * time.Second,
+		HTTPConfig:     HTTPConfig{TLSConfig: TLSConfig{ServerName: "foo.com"}},
+	})
+	require.NoError(t, err)
+
+	_, err = NewScrapePool(&ScrapeConfig{
+		HTTPConfig: HTTPConfig{TLSConfig: TLSConfig{CAFile: "testdata/missing.crt"}},
+	})
+	require.Error(t, err)
+
+	plain, _ := url.Parse("https://plain.com")
+	internal, _ := url.Parse("https://internal.com")
+	broken, _ := url.Parse("https://broken.com")
+
+	scraperOf := func(t *Target) *targetScraper {
+		return sp.newTargetLoop(t).(*scrapeLoop).scraper.(*targetScraper)
+	}
+
+	// Targets without TLS settings of their own share the client of the pool.
+	ts := scraperOf(NewTarget(plain))
+	require.True(t, ts.client == sp.client)
+
+	ts = scraperOf(NewTargetWithOptions(internal, nil, TargetOptions{
+		HTTPConfig: HTTPConfig{TLSConfig: TLSConfig{InsecureSkipVerify: true}},
+	}))
+	require.NotNil(t, ts.client)
+	require.False(t, ts.client == sp.client)
+	require.Equal(t, TLSConfig{ServerName: "foo.com", InsecureSkipVerify: true}, ts.httpConfig.TLSConfig)
+
+	// Targets whose client can't be created fail every scrape.
+	ts = scraperOf(NewTargetWithOptions(broken, nil, TargetOptions{
+		HTTPConfig: HTTPConfig{TLSConfig: TLSConfig{CAFile: "testdata/missing.crt"}},
+	}))
+	require.Nil(t, ts.client)
+	err = ts.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "reading CA file")
+}
+
+func TestNewClientProxy(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		proxied []string
+	)
+	proxy := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.Lock()
+			proxied = append(proxied, r.URL.String())
+			mtx.Unlock()
+			w.Write([]byte("ok"))
+		}),
+	)
+	defer proxy.Close()
+
+	scrape := func(cfg HTTPConfig, u string) error {
+		client, err := newClient(cfg)
+		require.NoError(t, err)
+		targetURL, _ := url.Parse(u)
+		ts := &targetScraper{
+			Target: NewTarget(targetURL),
+			client: client,
+		}
+		return ts.scrape(context.Background())
+	}
+
+	// The host of the target is only resolved by the proxy.
+	require.NoError(t, scrape(HTTPConfig{ProxyURL: proxy.URL}, "http://foo.example/health"))
+
+	err := scrape(HTTPConfig{ProxyURL: proxy.URL, NoProxy: []string{"10.0.0.0/8", ".example"}}, "http://foo.example/health")
+	require.Error(t, err)
+
+	mtx.Lock()
+	require.Equal(t, []string{"http://foo.example/health"}, proxied)
+	mtx.Unlock()
+
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.example", nil)
+	proxyURL, err := HTTPConfig{ProxyURL: "socks5://egress:1080"}.proxyFunc()(req)
+	require.NoError(t, err)
+	require.Equal(t, "socks5://egress:1080", proxyURL.String())
+
+	proxyURL, err = HTTPConfig{ProxyURL: "socks5://egress:1080", NoProxy: []string{"*"}}.proxyFunc()(req)
+	require.NoError(t, err)
+	require.Nil(t, proxyURL)
+
+	require.Nil(t, HTTPConfig{}.proxyFunc())
+	require.True(t, HTTPConfig{NoProxy: []string{"*"}}.ownClient())
+	require.False(t, HTTPConfig{BearerToken: "abc"}.ownClient())
+}
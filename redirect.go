@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMaxRedirects is the number of redirects followed by default, as by
+// the clients of net/http.
+const defaultMaxRedirects = 10
+
+// RedirectConfig configures how redirects of responses are handled.
+// Redirect loops and redirects from HTTPS to HTTP always fail.
+type RedirectConfig struct {
+	// Whether redirects are followed. Defaults to true; otherwise the
+	// redirect itself is the response.
+	Follow *bool `yaml:"follow"`
+	// The maximum number of redirects followed. Defaults to 10.
+	MaxHops int `yaml:"max_hops"`
+	// A regular expression the URL of the final response must match.
+	FinalURLRegex string `yaml:"final_url_regex"`
+}
+
+// merge returns the config with the settings set in o overriding its own.
+func (c RedirectConfig) merge(o RedirectConfig) RedirectConfig {
+	if o.Follow != nil {
+		c.Follow = o.Follow
+	}
+	if o.MaxHops > 0 {
+		c.MaxHops = o.MaxHops
+	}
+	if o.FinalURLRegex != "" {
+		c.FinalURLRegex = o.FinalURLRegex
+	}
+	return c
+}
+
+// validate checks the settings.
+func (c RedirectConfig) validate(pos position) error {
+	if c.MaxHops < 0 {
+		return pos.key("max_hops").errorf("max_hops must not be negative")
+	}
+	if _, err := regexp.Compile(c.FinalURLRegex); err != nil {
+		return pos.key("final_url_regex").errorf("invalid regexp %q: %s", c.FinalURLRegex, err)
+	}
+	return nil
+}
+
+// checkRedirect implements the CheckRedirect policy of http.Client. via
+// holds the requests made so far, oldest first.
+func (c RedirectConfig) checkRedirect(req *http.Request, via []*http.Request) error {
+	if c.Follow != nil && !*c.Follow {
+		return http.ErrUseLastResponse
+	}
+	maxHops := c.MaxHops
+	if maxHops == 0 {
+		maxHops = defaultMaxRedirects
+	}
+	if len(via) > maxHops {
+		return errors.Errorf("stopped after %d redirects", maxHops)
+	}
+	last := via[len(via)-1]
+	if last.URL.Scheme == "https" && req.URL.Scheme == "http" {
+		return errors.Errorf("redirect from %s to %s downgrades HTTPS to HTTP", last.URL, req.URL)
+	}
+	for _, r := range via {
+		if r.URL.String() == req.URL.String() {
+			return errors.Errorf("redirect loop at %s", req.URL)
+		}
+	}
+	return nil
+}
+
+// compileFinalURLRegex compiles the regexp the URL of the final response
+// must match, which is nil if none is configured.
+func (c RedirectConfig) compileFinalURLRegex() (*regexp.Regexp, error) {
+	if c.FinalURLRegex == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(c.FinalURLRegex)
+	if err != nil {
+		return nil, errors.Errorf("redirects: invalid regexp %q: %s", c.FinalURLRegex, err)
+	}
+	return re, nil
+}
+
+// checkFinalURL returns an error if the URL of the final response doesn't
+// match the regexp, if any.
+func checkFinalURL(re *regexp.Regexp, finalURL string) error {
+	if re != nil && !re.MatchString(finalURL) {
+		return errors.Errorf("final URL %s did not match regexp %q", finalURL, re)
+	}
+	return nil
+}
+
+// redirectCount returns the number of redirects which led to a response.
+func redirectCount(resp *http.Response) int {
+	n := 0
+	for r := resp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,148 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetScraperScrapeRedirects(t *testing.T) {
+	plain := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/a":
+				http.Redirect(w, r, "/b", http.StatusFound)
+			case "/b":
+				http.Redirect(w, r, "/c", http.StatusMovedPermanently)
+			case "/loop":
+				http.Redirect(w, r, "/loop2", http.StatusFound)
+			case "/loop2":
+				http.Redirect(w, r, "/loop", http.StatusFound)
+			default:
+				w.Write([]byte("ok"))
+			}
+		}),
+	)
+	defer plain.Close()
+
+	secure := httptest.NewTLSServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, plain.URL+"/c", http.StatusFound)
+		}),
+	)
+	defer secure.Close()
+
+	follow, noFollow := true, false
+	for _, c := range []struct {
+		name       string
+		url        string
+		httpConfig HTTPConfig
+		redirects  int
+		finalURL   string
+		err        string
+	}{
+		{
+			name:      "follow",
+			url:       plain.URL + "/a",
+			redirects: 2,
+			finalURL:  plain.URL + "/c",
+		},
+		{
+			name:       "explicitly follow",
+			url:        plain.URL + "/a",
+			httpConfig: HTTPConfig{Redirects: RedirectConfig{Follow: &follow}},
+			redirects:  2,
+			finalURL:   plain.URL + "/c",
+		},
+		{
+			name:       "don't follow",
+			url:        plain.URL + "/a",
+			httpConfig: HTTPConfig{Redirects: RedirectConfig{Follow: &noFollow}},
+			finalURL:   plain.URL + "/a",
+			err:        "server returned HTTP status 302 Found",
+		},
+		{
+			name: "don't follow with valid redirect",
+			url:  plain.URL + "/a",
+			httpConfig: HTTPConfig{
+				Redirects:        RedirectConfig{Follow: &noFollow},
+				ValidStatusCodes: []string{"3xx"},
+			},
+			finalURL: plain.URL + "/a",
+		},
+		{
+			name:       "max hops",
+			url:        plain.URL + "/a",
+			httpConfig: HTTPConfig{Redirects: RedirectConfig{MaxHops: 1}},
+			err:        "stopped after 1 redirects",
+		},
+		{
+			name: "loop",
+			url:  plain.URL + "/loop",
+			err:  "redirect loop at " + plain.URL + "/loop",
+		},
+		{
+			name: "downgrade",
+			url:  secure.URL,
+			err:  "downgrades HTTPS to HTTP",
+		},
+		{
+			name:       "final URL",
+			url:        plain.URL + "/a",
+			httpConfig: HTTPConfig{Redirects: RedirectConfig{FinalURLRegex: "/c$"}},
+			redirects:  2,
+			finalURL:   plain.URL + "/c",
+		},
+		{
+			name:       "unexpected final URL",
+			url:        plain.URL + "/a",
+			httpConfig: HTTPConfig{Redirects: RedirectConfig{FinalURLRegex: "/b$"}},
+			redirects:  2,
+			finalURL:   plain.URL + "/c",
+			err:        `final URL ` + plain.URL + `/c did not match regexp "/b$"`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			c.httpConfig.TLSConfig = TLSConfig{InsecureSkipVerify: true}
+			client, err := newClient(c.httpConfig)
+			require.NoError(t, err)
+
+			targetURL, _ := url.Parse(c.url)
+			ts := newTargetScraper(NewTarget(targetURL), c.httpConfig)
+			ts.client = client
+
+			err = ts.scrape(context.Background())
+			if c.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.err)
+			}
+
+			var resp TargetResponse
+			ts.annotate(&resp)
+			require.Equal(t, c.redirects, resp.Redirects)
+			require.Equal(t, c.finalURL, resp.FinalURL)
+		})
+	}
+}
+
+func TestRedirectConfigMerge(t *testing.T) {
+	follow := false
+	base := RedirectConfig{MaxHops: 3, FinalURLRegex: "^https://"}
+
+	require.Equal(t, base, base.merge(RedirectConfig{}))
+	require.Equal(t,
+		RedirectConfig{Follow: &follow, MaxHops: 3, FinalURLRegex: "/health$"},
+		base.merge(RedirectConfig{Follow: &follow, FinalURLRegex: "/health$"}),
+	)
+
+	// A client of net/http is needed to control redirects.
+	client, err := newClient(HTTPConfig{Redirects: base})
+	require.NoError(t, err)
+	require.NotNil(t, client.(*http.Client).CheckRedirect)
+}
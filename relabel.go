@@ -0,0 +1,292 @@
+package scraper
+
+import (
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RelabelAction is the action a relabel config performs.
+type RelabelAction string
+
+const (
+	// RelabelReplace sets target_label to replacement, expanded with the
+	// regex groups matched against the concatenated source_labels.
+	RelabelReplace RelabelAction = "replace"
+	// RelabelKeep drops label sets whose source_labels don't match regex.
+	RelabelKeep RelabelAction = "keep"
+	// RelabelDrop drops label sets whose source_labels match regex.
+	RelabelDrop RelabelAction = "drop"
+	// RelabelLabelMap copies the values of labels whose names match regex to
+	// labels named by replacement.
+	RelabelLabelMap RelabelAction = "labelmap"
+	// RelabelLabelDrop removes the labels whose names match regex.
+	RelabelLabelDrop RelabelAction = "labeldrop"
+	// RelabelHashMod sets target_label to the modulus of a hash of the
+	// concatenated source_labels.
+	RelabelHashMod RelabelAction = "hashmod"
+)
+
+// Labels set on discovered targets before they are relabeled. Labels
+// starting with "__" are removed after relabeling.
+const (
+	// The target as given in its target group.
+	addressLabel = "__address__"
+	// The scheme of targets given as host:port.
+	schemeLabel = "__scheme__"
+	// The path of targets given as host:port.
+	metricsPathLabel = "__metrics_path__"
+	// The scrape interval of the target.
+	scrapeIntervalLabel = "__scrape_interval__"
+	// The scrape timeout of the target.
+	scrapeTimeoutLabel = "__scrape_timeout__"
+	// The HTTP method of the target's requests.
+	methodLabel = "__method__"
+	// The Host header of the target's requests.
+	hostLabel = "__host__"
+	// The body of the target's requests.
+	bodyLabel = "__body__"
+	// The file to read the body of the target's requests from.
+	bodyFileLabel = "__body_file__"
+	// The prefix of labels setting a header of the target's requests.
+	headerLabelPrefix = "__header_"
+	// The comma separated valid status codes of the target's responses.
+	validStatusCodesLabel = "__valid_status_codes__"
+	// Whether the status codes of the target's responses are inverted.
+	invertStatusCodesLabel = "__invert_status_codes__"
+	// Body assertions of the target's responses, added to those of the
+	// scrape config.
+	bodyMustMatchLabel    = "__body_must_match__"
+	bodyMustNotMatchLabel = "__body_must_not_match__"
+	bodyContainsLabel     = "__body_contains__"
+	bodyNotContainsLabel  = "__body_not_contains__"
+	bodyJSONPathLabel     = "__body_json_path__"
+	bodyJSONValueLabel    = "__body_json_value__"
+	// The prefix of labels setting the expected value of a header of the
+	// target's responses.
+	expectHeaderLabelPrefix = "__expect_header_"
+	// The comma separated headers of the target's responses to export.
+	exportHeadersLabel = "__export_headers__"
+	// The window in which expiring certificates of the target fail scrapes.
+	certExpiryWindowLabel = "__cert_expiry_window__"
+	// The TLS settings of the target.
+	tlsCAFileLabel             = "__tls_ca_file__"
+	tlsCertFileLabel           = "__tls_cert_file__"
+	tlsKeyFileLabel            = "__tls_key_file__"
+	tlsServerNameLabel         = "__tls_server_name__"
+	tlsInsecureSkipVerifyLabel = "__tls_insecure_skip_verify__"
+	tlsMinVersionLabel         = "__tls_min_version__"
+	// The authentication of the target's requests.
+	basicAuthUsernameLabel      = "__basic_auth_username__"
+	basicAuthPasswordLabel      = "__basic_auth_password__"
+	basicAuthPasswordFileLabel  = "__basic_auth_password_file__"
+	bearerTokenLabel            = "__bearer_token__"
+	bearerTokenFileLabel        = "__bearer_token_file__"
+	oauth2ClientIDLabel         = "__oauth2_client_id__"
+	oauth2ClientSecretLabel     = "__oauth2_client_secret__"
+	oauth2ClientSecretFileLabel = "__oauth2_client_secret_file__"
+	oauth2TokenURLLabel         = "__oauth2_token_url__"
+	// The comma separated scopes of the target's OAuth2 tokens.
+	oauth2ScopesLabel = "__oauth2_scopes__"
+	// The proxy of the target's requests.
+	proxyURLLabel = "__proxy_url__"
+	// The comma separated hosts reached without the proxy.
+	noProxyLabel = "__no_proxy__"
+	// The redirect settings of the target.
+	followRedirectsLabel = "__follow_redirects__"
+	maxRedirectsLabel    = "__max_redirects__"
+	finalURLRegexLabel   = "__final_url_regex__"
+	// The settings of the probes of a tcp:// target. The line of the send
+	// label is sent before the one of the expect label is expected.
+	tcpTLSLabel    = "__tcp_tls__"
+	tcpSendLabel   = "__tcp_send__"
+	tcpExpectLabel = "__tcp_expect__"
+	// The name of the metric, set for metric relabeling.
+	metricNameLabel = "__name__"
+)
+
+// DefaultRelabelConfig is the relabel config whose values are used for the
+// fields a config file doesn't set.
+var DefaultRelabelConfig = RelabelConfig{
+	Separator:   ";",
+	Regex:       "(.*)",
+	Replacement: "$1",
+	Action:      RelabelReplace,
+}
+
+// RelabelConfig is a rule to rewrite or filter the label set of a target or
+// a metric, in the format of the Prometheus relabel configs.
+type RelabelConfig struct {
+	// The labels whose values are concatenated and matched against regex.
+	SourceLabels []string `yaml:"source_labels"`
+	// The separator between the concatenated source label values.
+	Separator string `yaml:"separator"`
+	// The regular expression, which is anchored at both ends.
+	Regex string `yaml:"regex"`
+	// The modulus of the hashmod action.
+	Modulus uint64 `yaml:"modulus"`
+	// The label written by the replace and hashmod actions.
+	TargetLabel string `yaml:"target_label"`
+	// The value written by the replace action, or the label name written by
+	// the labelmap action. Regex groups are expanded.
+	Replacement string `yaml:"replacement"`
+	// The action to perform. Defaults to replace.
+	Action RelabelAction `yaml:"action"`
+
+	// The compiled, anchored regex. Set by validate.
+	regex *regexp.Regexp
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. Unset fields are filled from
+// DefaultRelabelConfig.
+func (c *RelabelConfig) UnmarshalYAML(value *yaml.Node) error {
+	*c = DefaultRelabelConfig
+	type plain RelabelConfig
+	return decodeStrict(value, (*plain)(c), "scraper.RelabelConfig")
+}
+
+// validate checks the config and compiles its regex.
+func (c *RelabelConfig) validate(pos position) error {
+	regex, err := regexp.Compile("^(?:" + c.Regex + ")$")
+	if err != nil {
+		return pos.key("regex").errorf("invalid regex %q: %s", c.Regex, err)
+	}
+	for i, name := range c.SourceLabels {
+		if !labelNameRE.MatchString(name) {
+			return pos.key("source_labels").index(i).errorf("invalid source label name %q", name)
+		}
+	}
+
+	c.Action = RelabelAction(strings.ToLower(string(c.Action)))
+	switch c.Action {
+	case "":
+		c.Action = RelabelReplace
+		fallthrough
+	case RelabelReplace:
+		if c.TargetLabel == "" {
+			return pos.key("target_label").errorf("relabel action %s requires a target_label", c.Action)
+		}
+		// The target label may refer to regex groups, so it can only be
+		// checked once it is expanded.
+		if !strings.Contains(c.TargetLabel, "$") && !labelNameRE.MatchString(c.TargetLabel) {
+			return pos.key("target_label").errorf("invalid target_label %q", c.TargetLabel)
+		}
+	case RelabelHashMod:
+		if c.TargetLabel == "" {
+			return pos.key("target_label").errorf("relabel action %s requires a target_label", c.Action)
+		}
+		if !labelNameRE.MatchString(c.TargetLabel) {
+			return pos.key("target_label").errorf("invalid target_label %q", c.TargetLabel)
+		}
+		if c.Modulus == 0 {
+			return pos.key("modulus").errorf("relabel action %s requires a modulus greater than zero", c.Action)
+		}
+	case RelabelKeep, RelabelDrop:
+	case RelabelLabelMap, RelabelLabelDrop:
+		if len(c.SourceLabels) > 0 {
+			return pos.key("source_labels").errorf("relabel action %s doesn't use source_labels", c.Action)
+		}
+		if c.TargetLabel != "" {
+			return pos.key("target_label").errorf("relabel action %s doesn't use a target_label", c.Action)
+		}
+	default:
+		return pos.key("action").errorf("unknown relabel action %q", c.Action)
+	}
+
+	c.regex = regex
+	return nil
+}
+
+// validateRelabelConfigs validates the relabel configs at the given position.
+func validateRelabelConfigs(pos position, cfgs []*RelabelConfig) error {
+	for i, rc := range cfgs {
+		rpos := pos.index(i)
+		if rc == nil {
+			return rpos.errorf("empty relabel config")
+		}
+		if err := rc.validate(rpos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relabel applies the relabel configs to a copy of the label set and returns
+// it, or nil if the label set is dropped. The configs must be validated.
+func relabel(labels map[string]string, cfgs ...*RelabelConfig) map[string]string {
+	lset := make(map[string]string, len(labels))
+	for name, value := range labels {
+		lset[name] = value
+	}
+	for _, cfg := range cfgs {
+		if !cfg.apply(lset) {
+			return nil
+		}
+	}
+	return lset
+}
+
+// apply applies the config to the label set in place. It returns false if
+// the label set is dropped.
+func (c *RelabelConfig) apply(lset map[string]string) bool {
+	values := make([]string, 0, len(c.SourceLabels))
+	for _, name := range c.SourceLabels {
+		values = append(values, lset[name])
+	}
+	val := strings.Join(values, c.Separator)
+
+	switch c.Action {
+	case RelabelKeep:
+		return c.regex.MatchString(val)
+	case RelabelDrop:
+		return !c.regex.MatchString(val)
+	case RelabelReplace:
+		indexes := c.regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			break
+		}
+		target := string(c.regex.ExpandString(nil, c.TargetLabel, val, indexes))
+		if !labelNameRE.MatchString(target) {
+			break
+		}
+		res := string(c.regex.ExpandString(nil, c.Replacement, val, indexes))
+		if res == "" {
+			delete(lset, target)
+			break
+		}
+		lset[target] = res
+	case RelabelHashMod:
+		lset[c.TargetLabel] = fmt.Sprint(sum64(md5.Sum([]byte(val))) % c.Modulus)
+	case RelabelLabelMap:
+		mapped := map[string]string{}
+		for name, value := range lset {
+			if c.regex.MatchString(name) {
+				mapped[c.regex.ReplaceAllString(name, c.Replacement)] = value
+			}
+		}
+		for name, value := range mapped {
+			lset[name] = value
+		}
+	case RelabelLabelDrop:
+		for name := range lset {
+			if c.regex.MatchString(name) {
+				delete(lset, name)
+			}
+		}
+	}
+	return true
+}
+
+// sum64 returns the last 8 bytes of the hash as an integer, as Prometheus
+// does for the hashmod action.
+func sum64(hash [md5.Size]byte) uint64 {
+	var s uint64
+	for i, b := range hash {
+		shift := uint64((md5.Size - i - 1) * 8)
+		s |= uint64(b) << shift
+	}
+	return s
+}
@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelabel(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		config *RelabelConfig
+		input  map[string]string
+		output map[string]string
+	}{
+		{
+			name: "replace",
+			config: &RelabelConfig{
+				SourceLabels: []string{"a", "b"},
+				Separator:    ";",
+				Regex:        "f(.*);(.*)",
+				TargetLabel:  "c",
+				Replacement:  "${1}-${2}",
+				Action:       RelabelReplace,
+			},
+			input:  map[string]string{"a": "foo", "b": "bar"},
+			output: map[string]string{"a": "foo", "b": "bar", "c": "oo-bar"},
+		},
+		{
+			name: "replace without match",
+			config: &RelabelConfig{
+				SourceLabels: []string{"a"},
+				Regex:        "x.*",
+				TargetLabel:  "c",
+				Replacement:  "$1",
+				Action:       RelabelReplace,
+			},
+			input:  map[string]string{"a": "foo"},
+			output: map[string]string{"a": "foo"},
+		},
+		{
+			name: "replace with empty value deletes",
+			config: &RelabelConfig{
+				SourceLabels: []string{"a"},
+				Regex:        "(.*)",
+				TargetLabel:  "b",
+				Action:       RelabelReplace,
+			},
+			input:  map[string]string{"a": "foo", "b": "bar"},
+			output: map[string]string{"a": "foo"},
+		},
+		{
+			name: "keep",
+			config: &RelabelConfig{
+				SourceLabels: []string{"env"},
+				Regex:        "prod",
+				Action:       RelabelKeep,
+			},
+			input:  map[string]string{"env": "dev"},
+			output: nil,
+		},
+		{
+			name: "drop",
+			config: &RelabelConfig{
+				SourceLabels: []string{"env"},
+				Regex:        "dev|test",
+				Action:       RelabelDrop,
+			},
+			input:  map[string]string{"env": "prod"},
+			output: map[string]string{"env": "prod"},
+		},
+		{
+			name: "labelmap",
+			config: &RelabelConfig{
+				Regex:       "__meta_(.+)",
+				Replacement: "$1",
+				Action:      RelabelLabelMap,
+			},
+			input:  map[string]string{"__meta_zone": "eu", "a": "b"},
+			output: map[string]string{"__meta_zone": "eu", "zone": "eu", "a": "b"},
+		},
+		{
+			name: "labeldrop",
+			config: &RelabelConfig{
+				Regex:  "tmp_.*",
+				Action: RelabelLabelDrop,
+			},
+			input:  map[string]string{"tmp_a": "1", "tmp_b": "2", "a": "b"},
+			output: map[string]string{"a": "b"},
+		},
+		{
+			name: "hashmod",
+			config: &RelabelConfig{
+				SourceLabels: []string{"a"},
+				Regex:        "(.*)",
+				Modulus:      1000,
+				TargetLabel:  "shard",
+				Action:       RelabelHashMod,
+			},
+			input:  map[string]string{"a": "foo"},
+			output: map[string]string{"a": "foo", "shard": "696"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.NoError(t, c.config.validate(position{}))
+			require.Equal(t, c.output, relabel(c.input, c.config))
+		})
+	}
+}
+
+func TestRelabelKeepsInput(t *testing.T) {
+	cfg := &RelabelConfig{Regex: ".*", Action: RelabelLabelDrop}
+	require.NoError(t, cfg.validate(position{}))
+
+	input := map[string]string{"a": "b"}
+	require.Empty(t, relabel(input, cfg))
+	require.Equal(t, map[string]string{"a": "b"}, input)
+}
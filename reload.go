@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reloader reloads the config file of a Manager when the process receives
+// SIGHUP or when the content of the file changes.
+type Reloader struct {
+	filename string
+	manager  *Manager
+
+	mtx sync.Mutex
+	// Checksum of the file content the last reload was attempted with.
+	checksum [sha256.Size]byte
+
+	lastReloadSuccessful       prometheus.Gauge
+	lastReloadSuccessTimestamp prometheus.Gauge
+}
+
+// NewReloader creates a reloader for the given config file and registers its
+// metrics with the registerer of the manager.
+func NewReloader(filename string, m *Manager) (*Reloader, error) {
+	r := &Reloader{
+		filename: filename,
+		manager:  m,
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "sample",
+			Name:      "config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful.",
+		}),
+		lastReloadSuccessTimestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "sample",
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload.",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{r.lastReloadSuccessful, r.lastReloadSuccessTimestamp} {
+		if err := m.registerer.Register(c); err != nil {
+			return nil, errors.Wrap(err, "registering reload metrics")
+		}
+	}
+	return r, nil
+}
+
+// Reload loads the config file and applies it to the manager. If it fails,
+// the previously applied config keeps running.
+func (r *Reloader) Reload() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	b, err := ioutil.ReadFile(r.filename)
+	if err != nil {
+		r.lastReloadSuccessful.Set(0)
+		return err
+	}
+	return r.reload(b)
+}
+
+// Run reloads the config on SIGHUP and whenever the file content changed,
+// which is checked every checkInterval. It returns when ctx is done.
+func (r *Reloader) Run(ctx context.Context, checkInterval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := r.Reload(); err != nil {
+				log.Println("msg", "Reloading config failed", "err", err)
+			}
+		case <-ticker.C:
+			if err := r.reloadIfChanged(); err != nil {
+				log.Println("msg", "Reloading config failed", "err", err)
+			}
+		}
+	}
+}
+
+// reloadIfChanged reloads the config if the content of the file differs from
+// the last reload attempt.
+func (r *Reloader) reloadIfChanged() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	b, err := ioutil.ReadFile(r.filename)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(b) == r.checksum {
+		return nil
+	}
+	return r.reload(b)
+}
+
+// reload applies the config content and updates the reload metrics.
+func (r *Reloader) reload(b []byte) (err error) {
+	r.checksum = sha256.Sum256(b)
+
+	defer func() {
+		if err != nil {
+			r.lastReloadSuccessful.Set(0)
+			return
+		}
+		r.lastReloadSuccessful.Set(1)
+		r.lastReloadSuccessTimestamp.SetToCurrentTime()
+	}()
+
+	cfg, err := Load(b)
+	if err != nil {
+		return errors.Wrapf(err, "parsing config file %s", r.filename)
+	}
+	return r.manager.ApplyConfig(cfg)
+}
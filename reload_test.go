@@ -0,0 +1,108 @@
+package scraper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "scraper.yml")
+	writeConfig := func(s string) {
+		require.NoError(t, ioutil.WriteFile(filename, []byte(s), 0644))
+	}
+
+	writeConfig(`
+scrape_configs:
+  - job_name: web
+    scrape_interval: 1h
+`)
+
+	m := NewManager(prometheus.NewRegistry())
+	defer m.Stop()
+
+	r, err := NewReloader(filename, m)
+	require.NoError(t, err)
+
+	require.NoError(t, r.Reload())
+	require.Equal(t, float64(1), testutil.ToFloat64(r.lastReloadSuccessful))
+	require.NotZero(t, testutil.ToFloat64(r.lastReloadSuccessTimestamp))
+	require.Contains(t, m.ScrapePools(), "web")
+
+	// A broken config keeps the old one running.
+	writeConfig(`
+scrape_configs:
+  - job_name: api
+    scrape_interval: 1h
+    scrape_timeout: 2h
+`)
+	require.Error(t, r.reloadIfChanged())
+	require.Equal(t, float64(0), testutil.ToFloat64(r.lastReloadSuccessful))
+	require.Contains(t, m.ScrapePools(), "web")
+
+	// The same broken content is not retried.
+	require.NoError(t, r.reloadIfChanged())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, 10*time.Millisecond)
+
+	writeConfig(`
+scrape_configs:
+  - job_name: api
+    scrape_interval: 1h
+`)
+	require.Eventually(t, func() bool {
+		_, ok := m.ScrapePools()["api"]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond, "changed config file should be reloaded")
+	require.Equal(t, float64(1), testutil.ToFloat64(r.lastReloadSuccessful))
+	require.NotContains(t, m.ScrapePools(), "web")
+}
+
+func TestReloaderSIGHUP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not supported on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "scraper")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "scraper.yml")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("scrape_configs: []"), 0644))
+
+	m := NewManager(prometheus.NewRegistry())
+	defer m.Stop()
+
+	r, err := NewReloader(filename, m)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, time.Hour)
+
+	// Wait for the reloader to be notified of signals.
+	time.Sleep(100 * time.Millisecond)
+
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, p.Signal(syscall.SIGHUP))
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(r.lastReloadSuccessful) == 1
+	}, 5*time.Second, 10*time.Millisecond, "config should be reloaded on SIGHUP")
+}
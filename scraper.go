@@ -1,7 +1,9 @@
 package scraper
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"hash/fnv"
 	"io"
@@ -9,10 +11,13 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/arriqaaq/boomerang"
 	"github.com/pkg/errors"
 )
 
@@ -26,29 +31,272 @@ const (
 	HealthBad     TargetHealth = 0
 )
 
+// maxBodySize is the size of the largest response bodies checked by body
+// assertions.
+const maxBodySize = 1 << 20
+
+// errHealthUnknown is wrapped by the errors of scrapes after which the health
+// of a target is unknown rather than bad, such as a gRPC service reporting
+// its status as UNKNOWN.
+var errHealthUnknown = errors.New("health unknown")
+
+// scrapeHealth returns the health of a target after a scrape which returned
+// the given error.
+func scrapeHealth(err error) TargetHealth {
+	switch {
+	case err == nil:
+		return HealthGood
+	case errors.Is(err, errHealthUnknown):
+		return HealthUnknown
+	default:
+		return HealthBad
+	}
+}
+
 // A scraper retrieves samples and accepts a status report at the end.
 type scraper interface {
 	scrape(ctx context.Context) error
 	report(start time.Time, dur time.Duration, err error)
 	offset(interval time.Duration, jitterSeed uint64) time.Duration
 	url() *url.URL
+	labels() map[string]string
+	// annotate adds the details of the last scrape to its response.
+	annotate(resp *TargetResponse)
 }
 
 // Store provides appends against a storage.
 type Store interface {
 	// Add adds a target response for the given target.
 	Add(url *url.URL, health TargetHealth, duration time.Duration) error
+	// Append adds a target response.
+	Append(resp TargetResponse) error
 	// Commit commits the entries and clears the store. This should be called when all the entries are committed/reported.
 	Commit() []TargetResponse
 }
 
+// HTTPConfig configures the requests sent to HTTP targets.
+type HTTPConfig struct {
+	// The HTTP method of the request. Defaults to GET.
+	Method string `yaml:"method"`
+	// Headers to set on every request.
+	Headers map[string]string `yaml:"headers"`
+	// The Host header of the request, if it differs from the URL's host.
+	Host string `yaml:"host"`
+	// The body of the request.
+	Body string `yaml:"body"`
+	// A file to read the body of the request from on every scrape.
+	BodyFile string `yaml:"body_file"`
+
+	// The status codes of successful responses, given as codes such as 204,
+	// classes such as 2xx or ranges such as 200-399. Defaults to 200.
+	ValidStatusCodes []string `yaml:"valid_status_codes"`
+	// Whether responses are successful if their status code is not valid.
+	InvertStatusCodes bool `yaml:"invert_status_codes"`
+	// Checks on the body of successful responses.
+	BodyAssertions BodyAssertions `yaml:"body_assertions"`
+	// Checks on the headers of successful responses.
+	HeaderAssertions []HeaderAssertion `yaml:"header_assertions"`
+	// Headers whose values are exported as labels of an info metric.
+	ExportHeaders []string `yaml:"export_headers"`
+	// Scrapes of HTTPS targets fail if a certificate of the chain expires
+	// within this window. Zero disables the check.
+	CertExpiryWindow time.Duration `yaml:"cert_expiry_window"`
+	// The TLS settings of HTTPS targets.
+	TLSConfig TLSConfig `yaml:"tls_config"`
+	// The URL of the proxy to send requests through, with the scheme http,
+	// https or socks5. Defaults to the proxy of the environment.
+	ProxyURL string `yaml:"proxy_url"`
+	// Hosts, domains such as .internal and IP ranges such as 10.0.0.0/8
+	// which are reached without the proxy. * disables the proxy.
+	NoProxy []string `yaml:"no_proxy"`
+	// How redirects are handled.
+	Redirects RedirectConfig `yaml:"redirects"`
+
+	// At most one kind of authentication of the requests.
+	BasicAuth BasicAuth `yaml:"basic_auth"`
+	// A bearer token, or a file to read it from on every scrape.
+	BearerToken     Secret       `yaml:"bearer_token"`
+	BearerTokenFile string       `yaml:"bearer_token_file"`
+	OAuth2          OAuth2Config `yaml:"oauth2"`
+}
+
+// merge returns the config with the settings set in o overriding its own.
+// Headers, TLS and redirect settings are merged, a body of o replaces both body
+// settings, authentication of o replaces any other, and the assertions,
+// exported headers and no_proxy entries of o are added.
+func (c HTTPConfig) merge(o HTTPConfig) HTTPConfig {
+	if o.Method != "" {
+		c.Method = o.Method
+	}
+	if len(o.Headers) > 0 {
+		headers := make(map[string]string, len(c.Headers)+len(o.Headers))
+		for name, value := range c.Headers {
+			headers[name] = value
+		}
+		for name, value := range o.Headers {
+			headers[name] = value
+		}
+		c.Headers = headers
+	}
+	if o.Host != "" {
+		c.Host = o.Host
+	}
+	if o.Body != "" || o.BodyFile != "" {
+		c.Body, c.BodyFile = o.Body, o.BodyFile
+	}
+	if len(o.ValidStatusCodes) > 0 || o.InvertStatusCodes {
+		c.ValidStatusCodes, c.InvertStatusCodes = o.ValidStatusCodes, o.InvertStatusCodes
+	}
+	c.BodyAssertions = c.BodyAssertions.merge(o.BodyAssertions)
+	if len(o.HeaderAssertions) > 0 {
+		c.HeaderAssertions = append(append([]HeaderAssertion(nil), c.HeaderAssertions...), o.HeaderAssertions...)
+	}
+	if len(o.ExportHeaders) > 0 {
+		c.ExportHeaders = append(append([]string(nil), c.ExportHeaders...), o.ExportHeaders...)
+	}
+	if o.CertExpiryWindow > 0 {
+		c.CertExpiryWindow = o.CertExpiryWindow
+	}
+	c.TLSConfig = c.TLSConfig.merge(o.TLSConfig)
+	if o.ProxyURL != "" {
+		c.ProxyURL = o.ProxyURL
+	}
+	if len(o.NoProxy) > 0 {
+		c.NoProxy = append(append([]string(nil), c.NoProxy...), o.NoProxy...)
+	}
+	c.Redirects = c.Redirects.merge(o.Redirects)
+	if o.authConfigured() {
+		c.BasicAuth, c.BearerToken, c.BearerTokenFile, c.OAuth2 = o.BasicAuth, o.BearerToken, o.BearerTokenFile, o.OAuth2
+	}
+	return c
+}
+
+// statusCodeValid reports whether a response with the given status code is
+// successful.
+func (c HTTPConfig) statusCodeValid(code int) bool {
+	valid := code == http.StatusOK
+	if len(c.ValidStatusCodes) > 0 {
+		valid = false
+		for _, codes := range c.ValidStatusCodes {
+			// The codes are validated with the config.
+			if min, max, err := parseStatusCodes(codes); err == nil && code >= min && code <= max {
+				valid = true
+				break
+			}
+		}
+	}
+	return valid != c.InvertStatusCodes
+}
+
+// parseStatusCodes returns the lowest and highest status code of a code
+// such as 204, a class such as 2xx or a range such as 200-399.
+func parseStatusCodes(s string) (int, int, error) {
+	var min, max int
+	switch {
+	case len(s) == 3 && strings.HasSuffix(s, "xx"):
+		class, err := strconv.Atoi(s[:1])
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid status code class %q", s)
+		}
+		min, max = class*100, class*100+99
+	case strings.Contains(s, "-"):
+		parts := strings.SplitN(s, "-", 2)
+		var err1, err2 error
+		min, err1 = strconv.Atoi(parts[0])
+		max, err2 = strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || min > max {
+			return 0, 0, errors.Errorf("invalid status code range %q", s)
+		}
+	default:
+		code, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid status code %q", s)
+		}
+		min, max = code, code
+	}
+	if min < 100 || max > 599 {
+		return 0, 0, errors.Errorf("status code %q out of range 100-599", s)
+	}
+	return min, max, nil
+}
+
+// body returns the body of the request, or nil if it has none.
+func (c HTTPConfig) body() ([]byte, error) {
+	if c.BodyFile != "" {
+		b, err := ioutil.ReadFile(c.BodyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading request body")
+		}
+		return b, nil
+	}
+	if c.Body != "" {
+		return []byte(c.Body), nil
+	}
+	return nil, nil
+}
+
+// doer sends HTTP requests.
+type doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
 // targetScraper implements the scraper interface for a target.
 type targetScraper struct {
 	*Target
 
-	client  *boomerang.HttpClient
-	req     *http.Request
-	timeout time.Duration
+	client     doer
+	clientErr  error
+	req        *http.Request
+	timeout    time.Duration
+	httpConfig HTTPConfig
+	// The assertions of the config with their regexps compiled.
+	bodyAssertions   *compiledBodyAssertions
+	headerAssertions []compiledHeaderAssertion
+	finalURLRegex    *regexp.Regexp
+	// The error compiling the regexps of the config, returned by every
+	// scrape.
+	compileErr error
+
+	// The status code of the last response, 0 if there was none.
+	lastStatusCode int
+	// The values of the exported headers of the last response.
+	lastHeaders map[string]string
+	// The durations of the phases of the last request.
+	lastPhases map[string]time.Duration
+	// The certificate chain of the last response, nil for plain HTTP.
+	lastCert *CertInfo
+	// The number of redirects and the URL of the last response.
+	lastRedirects int
+	lastFinalURL  string
+
+	// The cached token of the OAuth2 config.
+	oauth2Token oauth2Token
+}
+
+// newTargetScraper creates a scraper of the HTTP target with the config,
+// compiling the regexps of its assertions.
+func newTargetScraper(t *Target, httpConfig HTTPConfig) *targetScraper {
+	s := &targetScraper{
+		Target:     t,
+		httpConfig: httpConfig,
+	}
+	if s.compileErr = s.compile(); s.compileErr != nil {
+		log.Println("msg", "Compiling assertions failed", "target", t.URL(), "err", s.compileErr)
+	}
+	return s
+}
+
+// compile compiles the regexps of the assertions of the config.
+func (s *targetScraper) compile() error {
+	var err error
+	if s.bodyAssertions, err = s.httpConfig.BodyAssertions.compile(); err != nil {
+		return err
+	}
+	if s.headerAssertions, err = compileHeaderAssertions(s.httpConfig.HeaderAssertions); err != nil {
+		return err
+	}
+	s.finalURLRegex, err = s.httpConfig.Redirects.compileFinalURLRegex()
+	return err
 }
 
 // URL returns the target's URL.
@@ -56,31 +304,135 @@ func (s *targetScraper) url() *url.URL {
 	return s.URL()
 }
 
+// labels returns the target's labels.
+func (s *targetScraper) labels() map[string]string {
+	return s.Labels()
+}
+
+// annotate adds the status code, exported headers, phase durations,
+// certificate chain and redirects of the last response.
+func (s *targetScraper) annotate(resp *TargetResponse) {
+	resp.StatusCode = s.lastStatusCode
+	resp.Headers = s.lastHeaders
+	resp.Phases = s.lastPhases
+	resp.Cert = s.lastCert
+	resp.Redirects = s.lastRedirects
+	resp.FinalURL = s.lastFinalURL
+}
+
 func (s *targetScraper) scrape(ctx context.Context) error {
+	if s.client == nil {
+		return s.clientErr
+	}
+	if s.compileErr != nil {
+		return s.compileErr
+	}
 	if s.req == nil {
-		req, err := http.NewRequest("GET", s.URL().String(), nil)
+		method := s.httpConfig.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req, err := http.NewRequest(method, s.URL().String(), nil)
 		if err != nil {
 			return err
 		}
 		req.Header.Set("X-Scrape-Timeout-Seconds", fmt.Sprintf("%f", s.timeout.Seconds()))
+		for name, value := range s.httpConfig.Headers {
+			req.Header.Set(name, value)
+		}
+		// The Host header is taken from the request, not its headers.
+		if host := req.Header.Get("Host"); host != "" {
+			req.Host = host
+			req.Header.Del("Host")
+		}
+		if s.httpConfig.Host != "" {
+			req.Host = s.httpConfig.Host
+		}
 
 		s.req = req
 	}
 
-	resp, err := s.client.Do(s.req.WithContext(ctx))
+	s.lastStatusCode, s.lastHeaders, s.lastCert = 0, nil, nil
+	s.lastRedirects, s.lastFinalURL = 0, ""
+
+	trace := newPhaseTrace()
+	defer func() {
+		s.lastPhases = trace.phaseDurations()
+	}()
+	req := s.req.WithContext(trace.withContext(ctx))
+	if s.httpConfig.authConfigured() {
+		// The headers of the cached request are shared by all scrapes.
+		req.Header = s.req.Header.Clone()
+		if err := s.authorize(ctx, req); err != nil {
+			return err
+		}
+	}
+
+	reqBody, err := s.httpConfig.body()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		io.Copy(ioutil.Discard, resp.Body)
-		resp.Body.Close()
-	}()
+	if reqBody != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(reqBody)), nil
+		}
+		req.ContentLength = int64(len(reqBody))
+	}
 
-	if resp.StatusCode != http.StatusOK {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The body is read, or discarded, before any checks to time its
+	// transfer. Bodies larger than maxBodySize fail the assertions, which
+	// is known after reading one byte more.
+	var body []byte
+	if s.httpConfig.BodyAssertions.empty() {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+	} else {
+		body, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	}
+	trace.bodyRead()
+
+	s.lastStatusCode = resp.StatusCode
+	// Tokens may be revoked before they expire, or don't expire at all.
+	if resp.StatusCode == http.StatusUnauthorized {
+		s.oauth2Token.reset()
+	}
+	if len(s.httpConfig.ExportHeaders) > 0 {
+		s.lastHeaders = make(map[string]string, len(s.httpConfig.ExportHeaders))
+		for _, name := range s.httpConfig.ExportHeaders {
+			s.lastHeaders[name] = resp.Header.Get(name)
+		}
+	}
+	s.lastCert = certInfo(resp.TLS)
+	s.lastRedirects, s.lastFinalURL = redirectCount(resp), resp.Request.URL.String()
+
+	if !s.httpConfig.statusCodeValid(resp.StatusCode) {
 		return errors.Errorf("server returned HTTP status %s", resp.Status)
 	}
+	if err := checkFinalURL(s.finalURLRegex, s.lastFinalURL); err != nil {
+		return err
+	}
+	if s.lastCert != nil {
+		if err := s.lastCert.checkExpiry(s.httpConfig.CertExpiryWindow, time.Now()); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	if err := checkHeaders(s.headerAssertions, resp.Header); err != nil {
+		return err
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading response body")
+	}
+	if len(body) > maxBodySize {
+		return errors.Errorf("body exceeds %d bytes", maxBodySize)
+	}
+	return s.bodyAssertions.check(body)
 }
 
 // NewStorage creates a storage for storing target responses.
@@ -100,14 +452,17 @@ type Storage struct {
 
 // Add implements Store.
 func (t *Storage) Add(url *url.URL, health TargetHealth, duration time.Duration) error {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-
-	report := TargetResponse{
+	return t.Append(TargetResponse{
 		URL:          url,
 		Status:       health,
 		ResponseTime: duration,
-	}
+	})
+}
+
+// Append implements Store.
+func (t *Storage) Append(report TargetResponse) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
 
 	log.Println("report: ", report)
 	t.rws = append(t.rws, report)
@@ -124,20 +479,62 @@ func (t *Storage) Commit() []TargetResponse {
 	return resp
 }
 
+// resize sets the capacity the responses are collected with from the next
+// commit.
+func (t *Storage) resize(chSize int) {
+	t.mtx.Lock()
+	t.chSize = chSize
+	t.mtx.Unlock()
+}
+
 // TargetResponse refers to the query response from the target
 type TargetResponse struct {
-	URL          *url.URL      `json:"url"`
-	Status       TargetHealth  `json:"status"`
-	ResponseTime time.Duration `json:"response_time"`
+	URL          *url.URL          `json:"url"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Status       TargetHealth      `json:"status"`
+	ResponseTime time.Duration     `json:"response_time"`
+	// The HTTP status code of the response, 0 if there was none.
+	StatusCode int `json:"status_code,omitempty"`
+	// The values of the exported headers of the response, by header name.
+	Headers map[string]string `json:"headers,omitempty"`
+	// The durations of the phases of the request, by phase.
+	Phases map[string]time.Duration `json:"phases,omitempty"`
+	// The certificate chain of HTTPS responses.
+	Cert *CertInfo `json:"cert,omitempty"`
+	// The number of redirects followed and the URL of the final response,
+	// empty if there was none.
+	Redirects int    `json:"redirects,omitempty"`
+	FinalURL  string `json:"final_url,omitempty"`
+	// The statistics of the probes of ping:// targets.
+	Ping *PingStats `json:"ping,omitempty"`
 }
 
 // Target refers to a singular HTTP or HTTPS endpoint.
 type Target struct {
+	// mtx guards the state of the last scrape.
+	mtx                sync.RWMutex
 	lastError          error
 	lastScrape         time.Time
 	lastScrapeDuration time.Duration
 	health             TargetHealth
 	url                *url.URL
+	labels             map[string]string
+	options            TargetOptions
+}
+
+// TargetOptions overrides settings of the scrape pool for a single target.
+// Zero values keep the settings of the pool.
+type TargetOptions struct {
+	// How frequently to scrape the target.
+	ScrapeInterval time.Duration `json:"scrape_interval,omitempty"`
+	// The timeout for scraping the target.
+	ScrapeTimeout time.Duration `json:"scrape_timeout,omitempty"`
+
+	// The HTTP request settings of the target. Headers are added to those
+	// of the pool.
+	HTTPConfig
+	// The settings of the probes of a tcp:// target.
+	TCP TCPConfig `json:"tcp,omitempty"`
 }
 
 // NewTarget creates a target for querying.
@@ -148,17 +545,76 @@ func NewTarget(url *url.URL) *Target {
 	}
 }
 
+// NewTargetWithLabels creates a target for querying whose metrics carry the
+// given labels in addition to the url label.
+func NewTargetWithLabels(url *url.URL, labels map[string]string) *Target {
+	t := NewTarget(url)
+	t.labels = labels
+	return t
+}
+
+// NewTargetWithOptions creates a target for querying with the given labels
+// and settings overriding those of the scrape pool.
+func NewTargetWithOptions(url *url.URL, labels map[string]string, opts TargetOptions) *Target {
+	t := NewTargetWithLabels(url, labels)
+	t.options = opts
+	return t
+}
+
 // URL returns the target's URL.
 func (t *Target) URL() *url.URL {
 	return t.url
 }
 
+// Labels returns the target's labels.
+func (t *Target) Labels() map[string]string {
+	return t.labels
+}
+
+// Options returns the settings of the target overriding those of the scrape
+// pool.
+func (t *Target) Options() TargetOptions {
+	return t.options
+}
+
+// intervalAndTimeout returns the scrape interval and timeout of the target,
+// falling back to the given ones of the pool. A timeout of the pool longer
+// than the target's interval is capped to it.
+func (t *Target) intervalAndTimeout(interval, timeout time.Duration) (time.Duration, time.Duration) {
+	if t.options.ScrapeInterval > 0 {
+		interval = t.options.ScrapeInterval
+	}
+	if t.options.ScrapeTimeout > 0 {
+		timeout = t.options.ScrapeTimeout
+	} else if timeout > interval {
+		timeout = interval
+	}
+	return interval, timeout
+}
+
 // hash returns an identifying hash for the target.
 func (t *Target) hash() uint64 {
 	h := fnv.New64a()
 	//nolint: errcheck
 	h.Write([]byte(t.URL().String()))
 
+	for _, name := range sortedLabelNames(t.labels) {
+		//nolint: errcheck
+		h.Write([]byte("\xff" + name + "\xff" + t.labels[name]))
+	}
+
+	if !reflect.DeepEqual(t.options, TargetOptions{}) {
+		b, _ := json.Marshal(t.options)
+		//nolint: errcheck
+		h.Write(append([]byte("\xff"), b...))
+
+		// The secrets are redacted in JSON, but still tell targets apart.
+		for _, secret := range []Secret{t.options.BasicAuth.Password, t.options.BearerToken, t.options.OAuth2.ClientSecret} {
+			//nolint: errcheck
+			h.Write([]byte("\xff" + string(secret)))
+		}
+	}
+
 	return h.Sum64()
 }
 
@@ -181,14 +637,26 @@ func (t *Target) offset(interval time.Duration, jitterSeed uint64) time.Duration
 
 // report sets target data about the last scrape.
 func (t *Target) report(start time.Time, dur time.Duration, err error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
 
-	if err == nil {
-		t.health = HealthGood
-	} else {
-		t.health = HealthBad
-	}
-
+	t.health = scrapeHealth(err)
 	t.lastError = err
 	t.lastScrape = start
 	t.lastScrapeDuration = dur
 }
+
+// Health returns the health of the target after the last scrape.
+func (t *Target) Health() TargetHealth {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	return t.health
+}
+
+// LastError returns the error of the last scrape, such as a failed body
+// assertion, or nil if it succeeded.
+func (t *Target) LastError() error {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	return t.lastError
+}
@@ -1,10 +1,14 @@
 package scraper
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -138,3 +142,276 @@ func TestStorageAdd(t *testing.T) {
 	resp := s.Commit()[0]
 	require.Contains(t, resp.URL.String(), "http://foobar.com")
 }
+
+func TestTargetHashLabels(t *testing.T) {
+	serverURL, err := url.Parse("http://foobar.com")
+	require.NoError(t, err)
+
+	plain := NewTarget(serverURL)
+	prod := NewTargetWithLabels(serverURL, map[string]string{"env": "prod"})
+	dev := NewTargetWithLabels(serverURL, map[string]string{"env": "dev"})
+
+	require.NotEqual(t, plain.hash(), prod.hash())
+	require.NotEqual(t, prod.hash(), dev.hash())
+	require.Equal(t, prod.hash(), NewTargetWithLabels(serverURL, map[string]string{"env": "prod"}).hash())
+}
+
+func TestTargetIntervalAndTimeout(t *testing.T) {
+	serverURL, err := url.Parse("http://foobar.com")
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		opts              TargetOptions
+		interval, timeout time.Duration
+	}{
+		{opts: TargetOptions{}, interval: 15 * time.Second, timeout: 10 * time.Second},
+		{opts: TargetOptions{ScrapeInterval: 5 * time.Minute}, interval: 5 * time.Minute, timeout: 10 * time.Second},
+		{opts: TargetOptions{ScrapeInterval: 5 * time.Second}, interval: 5 * time.Second, timeout: 5 * time.Second},
+		{opts: TargetOptions{ScrapeInterval: 5 * time.Second, ScrapeTimeout: time.Second}, interval: 5 * time.Second, timeout: time.Second},
+	} {
+		target := NewTargetWithOptions(serverURL, nil, c.opts)
+		interval, timeout := target.intervalAndTimeout(15*time.Second, 10*time.Second)
+		require.Equal(t, c.interval, interval)
+		require.Equal(t, c.timeout, timeout)
+	}
+
+	fast := NewTargetWithOptions(serverURL, nil, TargetOptions{ScrapeInterval: 5 * time.Second})
+	require.NotEqual(t, NewTarget(serverURL).hash(), fast.hash())
+	require.Less(t, int64(fast.offset(5*time.Second, 0)), int64(5*time.Second))
+}
+
+func TestTargetScraperScrapeRequest(t *testing.T) {
+	type request struct {
+		method, host, apiKey, probe, body string
+	}
+	requests := make(chan request, 2)
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			requests <- request{
+				method: r.Method,
+				host:   r.Host,
+				apiKey: r.Header.Get("X-Api-Key"),
+				probe:  r.Header.Get("X-Probe"),
+				body:   string(body),
+			}
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	bodyFile := filepath.Join(t.TempDir(), "body.json")
+	require.NoError(t, ioutil.WriteFile(bodyFile, []byte(`{"ping":1}`), 0644))
+
+	pool := HTTPConfig{
+		Method:  http.MethodGet,
+		Headers: map[string]string{"X-Probe": "scraper", "X-Api-Key": "pool"},
+		Body:    "pool body",
+	}
+	target := NewTargetWithOptions(serverURL, nil, TargetOptions{HTTPConfig: HTTPConfig{
+		Method:   http.MethodPost,
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+		Host:     "api.example.com",
+		BodyFile: bodyFile,
+	}})
+	ts := &targetScraper{
+		Target: target,
+		client: boomerang.NewHttpClient(&boomerang.ClientConfig{
+			Transport:  boomerang.DefaultTransport(),
+			MaxRetries: 1,
+		}),
+		httpConfig: pool.merge(target.Options().HTTPConfig),
+	}
+
+	require.NoError(t, ts.scrape(context.Background()))
+	require.Equal(t, request{
+		method: http.MethodPost,
+		host:   "api.example.com",
+		apiKey: "secret",
+		probe:  "scraper",
+		body:   `{"ping":1}`,
+	}, <-requests)
+
+	// The body file is read again on every scrape.
+	require.NoError(t, ioutil.WriteFile(bodyFile, []byte(`{"ping":2}`), 0644))
+	require.NoError(t, ts.scrape(context.Background()))
+	require.Equal(t, `{"ping":2}`, (<-requests).body)
+
+	require.NoError(t, os.Remove(bodyFile))
+	require.Error(t, ts.scrape(context.Background()))
+}
+
+func TestHTTPConfigStatusCodeValid(t *testing.T) {
+	for _, c := range []struct {
+		config HTTPConfig
+		code   int
+		valid  bool
+	}{
+		{config: HTTPConfig{}, code: 200, valid: true},
+		{config: HTTPConfig{}, code: 204, valid: false},
+		{config: HTTPConfig{ValidStatusCodes: []string{"2xx"}}, code: 204, valid: true},
+		{config: HTTPConfig{ValidStatusCodes: []string{"2xx"}}, code: 301, valid: false},
+		{config: HTTPConfig{ValidStatusCodes: []string{"200-399", "401"}}, code: 301, valid: true},
+		{config: HTTPConfig{ValidStatusCodes: []string{"200-399", "401"}}, code: 401, valid: true},
+		{config: HTTPConfig{ValidStatusCodes: []string{"200-399", "401"}}, code: 403, valid: false},
+		{config: HTTPConfig{InvertStatusCodes: true}, code: 200, valid: false},
+		{config: HTTPConfig{ValidStatusCodes: []string{"5xx"}, InvertStatusCodes: true}, code: 404, valid: true},
+	} {
+		require.Equal(t, c.valid, c.config.statusCodeValid(c.code), "%v with %d", c.config, c.code)
+	}
+
+	for _, s := range []string{"6xx", "abc", "300-200", "99", "200-600"} {
+		_, _, err := parseStatusCodes(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestTargetScraperScrapeStatusCodes(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ts := &targetScraper{
+		Target: NewTarget(serverURL),
+		client: boomerang.NewHttpClient(&boomerang.ClientConfig{
+			Transport:  boomerang.DefaultTransport(),
+			MaxRetries: 1,
+		}),
+	}
+
+	err = ts.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "204")
+
+	var resp TargetResponse
+	ts.annotate(&resp)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	ts.httpConfig.ValidStatusCodes = []string{"2xx"}
+	require.NoError(t, ts.scrape(context.Background()))
+
+	ts.httpConfig.InvertStatusCodes = true
+	require.Error(t, ts.scrape(context.Background()))
+}
+
+func TestTargetScraperScrapeBodyAssertions(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"degraded"}`))
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ts := newTargetScraper(NewTarget(serverURL), HTTPConfig{BodyAssertions: BodyAssertions{
+		JSON: []JSONAssertion{{Path: "status", Value: "ok"}},
+	}})
+	ts.client = boomerang.NewHttpClient(&boomerang.ClientConfig{
+		Transport:  boomerang.DefaultTransport(),
+		MaxRetries: 1,
+	})
+
+	start := time.Now()
+	err = ts.scrape(context.Background())
+	ts.report(start, time.Since(start), err)
+
+	require.Equal(t, HealthBad, ts.Health())
+	require.EqualError(t, ts.LastError(), `JSON path "status" is "degraded", expected "ok"`)
+}
+
+func TestTargetScraperScrapeBodyTooLarge(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(bytes.Repeat([]byte("a"), maxBodySize))
+			w.Write([]byte("ok"))
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ts := newTargetScraper(NewTarget(serverURL), HTTPConfig{BodyAssertions: BodyAssertions{
+		MustMatch: []string{"ok"},
+	}})
+	ts.client = boomerang.NewHttpClient(&boomerang.ClientConfig{
+		Transport:  boomerang.DefaultTransport(),
+		MaxRetries: 1,
+	})
+
+	require.EqualError(t, ts.scrape(context.Background()), "body exceeds 1048576 bytes")
+}
+
+func TestTargetScraperScrapeHeaders(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-App-Version", "1.4.2")
+			w.Header().Set("Cache-Control", "no-cache")
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ts := newTargetScraper(NewTarget(serverURL), HTTPConfig{
+		HeaderAssertions: []HeaderAssertion{{Name: "Cache-Control", Regex: "max-age"}},
+		ExportHeaders:    []string{"X-App-Version", "X-Region"},
+	})
+	ts.client = boomerang.NewHttpClient(&boomerang.ClientConfig{
+		Transport:  boomerang.DefaultTransport(),
+		MaxRetries: 1,
+	})
+
+	err = ts.scrape(context.Background())
+	require.EqualError(t, err, `header "Cache-Control" with value "no-cache" did not match regexp "max-age"`)
+
+	var resp TargetResponse
+	ts.annotate(&resp)
+	require.Equal(t, map[string]string{"X-App-Version": "1.4.2", "X-Region": ""}, resp.Headers)
+}
+
+func TestTargetScraperScrapeServerError(t *testing.T) {
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+	)
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	client, err := newClient(HTTPConfig{})
+	require.NoError(t, err)
+
+	// Server errors are responses like any other, not retried.
+	ts := &targetScraper{
+		Target:     NewTarget(serverURL),
+		client:     client,
+		httpConfig: HTTPConfig{ValidStatusCodes: []string{"5xx"}},
+	}
+	require.NoError(t, ts.scrape(context.Background()))
+
+	var resp TargetResponse
+	ts.annotate(&resp)
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	ts.httpConfig.InvertStatusCodes = true
+	err = ts.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "500")
+}
@@ -0,0 +1,199 @@
+package scraper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TCPConfig configures the probes of tcp:// targets.
+type TCPConfig struct {
+	// Whether the connection is secured with TLS, using the tls_config of
+	// the scrape config.
+	TLS bool `yaml:"tls"`
+	// The steps of the conversation with the target, in order.
+	QueryResponse []TCPQueryResponse `yaml:"query_response"`
+}
+
+// TCPQueryResponse is a step of the conversation with a TCP target. If both
+// are set, the response is expected before the query is sent.
+type TCPQueryResponse struct {
+	// A regular expression a line read from the connection must match.
+	// Lines are read until one matches.
+	Expect string `yaml:"expect"`
+	// A line to send, without its trailing newline.
+	Send string `yaml:"send"`
+}
+
+// merge returns the config with the settings set in o overriding its own.
+// The steps of o are added.
+func (c TCPConfig) merge(o TCPConfig) TCPConfig {
+	if o.TLS {
+		c.TLS = true
+	}
+	if len(o.QueryResponse) > 0 {
+		c.QueryResponse = append(append([]TCPQueryResponse(nil), c.QueryResponse...), o.QueryResponse...)
+	}
+	return c
+}
+
+// validate checks the regular expressions.
+func (c TCPConfig) validate(pos position) error {
+	for i, qr := range c.QueryResponse {
+		if _, err := regexp.Compile(qr.Expect); err != nil {
+			return pos.key("query_response").index(i).key("expect").errorf("invalid regexp %q: %s", qr.Expect, err)
+		}
+	}
+	return nil
+}
+
+// tcpStep is a step of the conversation with a TCP target with its regexp
+// compiled.
+type tcpStep struct {
+	TCPQueryResponse
+
+	// The compiled Expect, nil without one.
+	expect *regexp.Regexp
+}
+
+// compileTCPSteps compiles the regular expressions of the steps.
+func compileTCPSteps(steps []TCPQueryResponse) ([]tcpStep, error) {
+	compiled := make([]tcpStep, 0, len(steps))
+	for _, qr := range steps {
+		step := tcpStep{TCPQueryResponse: qr}
+		if qr.Expect != "" {
+			re, err := regexp.Compile(qr.Expect)
+			if err != nil {
+				return nil, errors.Errorf("query_response: invalid regexp %q: %s", qr.Expect, err)
+			}
+			step.expect = re
+		}
+		compiled = append(compiled, step)
+	}
+	return compiled, nil
+}
+
+// tcpScraper implements the scraper interface for tcp:// targets.
+type tcpScraper struct {
+	*Target
+	proberTLS
+
+	config TCPConfig
+	// The steps of the config with their regexps compiled.
+	steps []tcpStep
+	// The error compiling the regexps of the config, returned by every
+	// scrape.
+	compileErr error
+
+	// The durations of the phases of the last connection.
+	lastPhases map[string]time.Duration
+}
+
+// newTCPScraper creates a scraper of the tcp:// target with the config,
+// compiling the regexps of its steps. TLS connections use the TLS config of
+// the HTTP config.
+func newTCPScraper(t *Target, config TCPConfig, httpConfig HTTPConfig) *tcpScraper {
+	s := &tcpScraper{
+		Target: t,
+		config: config,
+	}
+	if config.TLS {
+		s.proberTLS = newProberTLS(t, httpConfig)
+	}
+	if s.steps, s.compileErr = compileTCPSteps(config.QueryResponse); s.compileErr != nil {
+		log.Println("msg", "Compiling regexps failed", "target", t.URL(), "err", s.compileErr)
+	}
+	return s
+}
+
+// url returns the target's URL.
+func (s *tcpScraper) url() *url.URL {
+	return s.URL()
+}
+
+// labels returns the target's labels.
+func (s *tcpScraper) labels() map[string]string {
+	return s.Labels()
+}
+
+// annotate adds the phase durations and certificate chain of the last
+// connection.
+func (s *tcpScraper) annotate(resp *TargetResponse) {
+	resp.Phases = s.lastPhases
+	resp.Cert = s.lastCert
+}
+
+// scrape connects to the target and runs the conversation of the config.
+func (s *tcpScraper) scrape(ctx context.Context) error {
+	s.lastPhases, s.lastCert = nil, nil
+	if s.tlsErr != nil {
+		return s.tlsErr
+	}
+	if s.compileErr != nil {
+		return s.compileErr
+	}
+
+	phases := map[string]time.Duration{}
+	start := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.URL().Host)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+	phases[PhaseConnect] = time.Since(start)
+	s.lastPhases = phases
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	if s.config.TLS {
+		start = time.Now()
+		tlsConn, cert, err := tlsHandshake(conn, s.tlsConfig, s.URL().Hostname(), s.certExpiryWindow)
+		if tlsConn == nil {
+			return err
+		}
+		phases[PhaseTLS] = time.Since(start)
+		s.lastCert, conn = cert, tlsConn
+		if err != nil {
+			return err
+		}
+	}
+
+	return converse(conn, s.steps)
+}
+
+// converse runs the steps of a conversation on the connection.
+func converse(conn net.Conn, steps []tcpStep) error {
+	r := bufio.NewReader(conn)
+	for _, step := range steps {
+		if step.expect != nil {
+			for {
+				line, err := r.ReadString('\n')
+				if step.expect.MatchString(strings.TrimRight(line, "\r\n")) {
+					break
+				}
+				if err != nil {
+					return errors.Wrapf(err, "expected regexp %q not found", step.Expect)
+				}
+			}
+		}
+		if step.Send != "" {
+			if _, err := fmt.Fprintf(conn, "%s\n", step.Send); err != nil {
+				return errors.Wrap(err, "sending query")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package scraper
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// serveLines accepts connections on the listener, greets them with a banner
+// and answers PING with PONG until QUIT.
+func serveLines(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			conn.Write([]byte("+OK ready\r\n"))
+			r := bufio.NewReader(conn)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				switch strings.TrimSpace(line) {
+				case "PING":
+					conn.Write([]byte("PONG\r\n"))
+				case "QUIT":
+					return
+				default:
+					conn.Write([]byte("-ERR unknown command\r\n"))
+				}
+			}
+		}(conn)
+	}
+}
+
+func TestTCPScraperScrape(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go serveLines(l)
+
+	targetURL, _ := url.Parse("tcp://" + l.Addr().String())
+
+	for _, c := range []struct {
+		name  string
+		steps []TCPQueryResponse
+		err   string
+	}{
+		{
+			name: "connect",
+		},
+		{
+			name:  "banner",
+			steps: []TCPQueryResponse{{Expect: `^\+OK`}},
+		},
+		{
+			name: "query",
+			steps: []TCPQueryResponse{
+				{Expect: `^\+OK`, Send: "PING"},
+				{Expect: "^PONG$", Send: "QUIT"},
+			},
+		},
+		{
+			name: "unexpected response",
+			steps: []TCPQueryResponse{
+				{Send: "HELLO"},
+				{Expect: "^PONG$"},
+			},
+			err: `expected regexp "^PONG$" not found`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ts := newTCPScraper(NewTarget(targetURL), TCPConfig{QueryResponse: c.steps}, HTTPConfig{})
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err := ts.scrape(ctx)
+			if c.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.err)
+			}
+
+			var resp TargetResponse
+			ts.annotate(&resp)
+			require.Contains(t, resp.Phases, PhaseConnect)
+			require.Nil(t, resp.Cert)
+		})
+	}
+
+	// Nothing listens on the port of a closed listener.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedURL, _ := url.Parse("tcp://" + closed.Addr().String())
+	closed.Close()
+
+	ts := &tcpScraper{Target: NewTarget(closedURL)}
+	require.Error(t, ts.scrape(context.Background()))
+}
+
+func TestTCPScraperScrapeTLS(t *testing.T) {
+	// The test server provides a certificate for example.com.
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.StartTLS()
+	serverTLS := server.TLS
+	server.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+	require.NoError(t, err)
+	defer l.Close()
+	go serveLines(l)
+
+	targetURL, _ := url.Parse("tcp://" + l.Addr().String())
+	ts := newTCPScraper(NewTarget(targetURL), TCPConfig{
+		TLS:           true,
+		QueryResponse: []TCPQueryResponse{{Expect: `^\+OK`, Send: "PING"}, {Expect: "^PONG$"}},
+	}, HTTPConfig{})
+	ts.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	require.NoError(t, ts.scrape(context.Background()))
+
+	var resp TargetResponse
+	ts.annotate(&resp)
+	require.Contains(t, resp.Phases, PhaseTLS)
+	require.NotNil(t, resp.Cert)
+	require.Contains(t, resp.Cert.SANs, "example.com")
+
+	// The certificate of the test server is not trusted by default.
+	ts.tlsConfig = &tls.Config{}
+	err = ts.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "TLS handshake")
+}
+
+func TestScrapePoolNewScraper(t *testing.T) {
+	sp, err := NewScrapePool(&ScrapeConfig{
+		ScrapeInterval: 15 * time.Second,
+		ScrapeTimeout:  10 * time.Second,
+		HTTPConfig:     HTTPConfig{CertExpiryWindow: time.Hour},
+		TCPConfig:      TCPConfig{QueryResponse: []TCPQueryResponse{{Expect: "^220"}}},
+	})
+	require.NoError(t, err)
+
+	httpURL, _ := url.Parse("http://foo.com")
+	tcpURL, _ := url.Parse("tcp://db.internal:5432")
+
+	require.IsType(t, &targetScraper{}, sp.newScraper(NewTarget(httpURL)))
+
+	s := sp.newScraper(NewTargetWithOptions(tcpURL, nil, TargetOptions{
+		TCP: TCPConfig{TLS: true, QueryResponse: []TCPQueryResponse{{Send: "QUIT"}}},
+	}))
+	require.IsType(t, &tcpScraper{}, s)
+	ts := s.(*tcpScraper)
+	require.Equal(t, TCPConfig{TLS: true, QueryResponse: []TCPQueryResponse{{Expect: "^220"}, {Send: "QUIT"}}}, ts.config)
+	require.NotNil(t, ts.tlsConfig)
+	require.Equal(t, time.Hour, ts.certExpiryWindow)
+}
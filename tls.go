@@ -0,0 +1,144 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tlsVersions are the TLS versions by their config names.
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// TLSConfig configures the TLS connections to HTTPS targets.
+type TLSConfig struct {
+	// The CA certificates to verify the server certificates with, instead of
+	// those of the system.
+	CAFile string `yaml:"ca_file"`
+	// The client certificate and key for mutual TLS.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// The name the server certificates are verified for, and sent with SNI,
+	// if it differs from the host of the target.
+	ServerName string `yaml:"server_name"`
+	// Whether server certificates are not verified at all.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	// The minimum TLS version, one of TLS10, TLS11, TLS12 and TLS13.
+	MinVersion string `yaml:"min_version"`
+}
+
+// merge returns the config with the settings set in o overriding its own.
+func (c TLSConfig) merge(o TLSConfig) TLSConfig {
+	if o.CAFile != "" {
+		c.CAFile = o.CAFile
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		c.CertFile, c.KeyFile = o.CertFile, o.KeyFile
+	}
+	if o.ServerName != "" {
+		c.ServerName = o.ServerName
+	}
+	if o.InsecureSkipVerify {
+		c.InsecureSkipVerify = true
+	}
+	if o.MinVersion != "" {
+		c.MinVersion = o.MinVersion
+	}
+	return c
+}
+
+// validate checks the settings, but not the files.
+func (c TLSConfig) validate(pos position) error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return pos.errorf("both cert_file and key_file must be configured for client certificates")
+	}
+	if _, ok := tlsVersions[c.MinVersion]; c.MinVersion != "" && !ok {
+		return pos.key("min_version").errorf("unknown TLS version %q", c.MinVersion)
+	}
+	return nil
+}
+
+// newTLSConfig creates the TLS config of a transport, loading the CA and
+// client certificates.
+func (c TLSConfig) newTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tlsVersions[c.MinVersion],
+	}
+	if c.CAFile != "" {
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// proberTLS is the TLS state of the probers of targets other than HTTP ones.
+type proberTLS struct {
+	// The TLS config of TLS connections.
+	tlsConfig *tls.Config
+	// The error creating the TLS config, returned by every scrape.
+	tlsErr error
+	// Scrapes fail if the certificate chain expires within this window.
+	certExpiryWindow time.Duration
+
+	// The certificate chain of the last TLS connection.
+	lastCert *CertInfo
+}
+
+// newProberTLS creates the TLS state of the probes of the target from the
+// HTTP config, logging an error creating the TLS config.
+func newProberTLS(t *Target, httpConfig HTTPConfig) proberTLS {
+	p := proberTLS{certExpiryWindow: httpConfig.CertExpiryWindow}
+	p.tlsConfig, p.tlsErr = httpConfig.TLSConfig.newTLSConfig()
+	if p.tlsErr != nil {
+		log.Println("msg", "Creating TLS config failed", "target", t.URL(), "err", p.tlsErr)
+	}
+	return p
+}
+
+// tlsHandshake secures the connection to the host with TLS. It returns the
+// certificate chain of the server, which must not expire within the window.
+// The TLS connection is nil if the handshake failed.
+func tlsHandshake(conn net.Conn, cfg *tls.Config, host string, window time.Duration) (*tls.Conn, *CertInfo, error) {
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, nil, errors.Wrap(err, "TLS handshake")
+	}
+
+	state := tlsConn.ConnectionState()
+	cert := certInfo(&state)
+	if cert != nil {
+		if err := cert.checkExpiry(window, time.Now()); err != nil {
+			return tlsConn, cert, err
+		}
+	}
+	return tlsConn, cert, nil
+}
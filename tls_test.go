@@ -0,0 +1,177 @@
+package scraper
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCert creates a certificate signed by parent, or a self-signed CA
+// certificate if parent is nil, and writes it and its key to dir.
+func newTestCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return cert, key
+}
+
+func TestTargetScraperScrapeTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCA, clientCAKey := newTestCert(t, dir, "client-ca", nil, nil)
+	newTestCert(t, dir, "client", clientCA, clientCAKey)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA)
+
+	server := httptest.NewUnstartedServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+	)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MaxVersion: tls.VersionTLS12,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "server-ca.crt")
+	require.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	clientCert := TLSConfig{
+		CAFile:   caFile,
+		CertFile: filepath.Join(dir, "client.crt"),
+		KeyFile:  filepath.Join(dir, "client.key"),
+	}
+	// The certificate of the test server is valid for example.com and
+	// 127.0.0.1, but not for localhost.
+	localhostURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	for _, c := range []struct {
+		name      string
+		url       string
+		tlsConfig TLSConfig
+		err       string
+	}{
+		{
+			name:      "mutual TLS",
+			tlsConfig: clientCert,
+		},
+		{
+			name:      "without client certificate",
+			tlsConfig: TLSConfig{CAFile: caFile},
+			err:       "remote error: tls",
+		},
+		{
+			name:      "unknown CA",
+			tlsConfig: TLSConfig{CertFile: clientCert.CertFile, KeyFile: clientCert.KeyFile},
+			err:       "certificate signed by unknown authority",
+		},
+		{
+			name:      "insecure",
+			tlsConfig: TLSConfig{CertFile: clientCert.CertFile, KeyFile: clientCert.KeyFile, InsecureSkipVerify: true},
+		},
+		{
+			name:      "wrong server name",
+			url:       localhostURL,
+			tlsConfig: clientCert,
+			err:       "not localhost",
+		},
+		{
+			name:      "server name",
+			url:       localhostURL,
+			tlsConfig: clientCert.merge(TLSConfig{ServerName: "example.com"}),
+		},
+		{
+			name:      "min version",
+			tlsConfig: clientCert.merge(TLSConfig{MinVersion: "TLS13"}),
+			err:       "protocol version",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if c.url == "" {
+				c.url = server.URL
+			}
+			serverURL, err := url.Parse(c.url)
+			require.NoError(t, err)
+
+			client, err := newClient(HTTPConfig{TLSConfig: c.tlsConfig})
+			require.NoError(t, err)
+			ts := &targetScraper{
+				Target: NewTarget(serverURL),
+				client: client,
+			}
+
+			err = ts.scrape(context.Background())
+			if c.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.err)
+		})
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	newTestCert(t, dir, "ca", nil, nil)
+
+	_, err := TLSConfig{CAFile: filepath.Join(dir, "missing.crt")}.newTLSConfig()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "reading CA file")
+
+	_, err = TLSConfig{CAFile: filepath.Join(dir, "ca.key")}.newTLSConfig()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no certificates found in CA file")
+
+	_, err = TLSConfig{CertFile: filepath.Join(dir, "ca.crt"), KeyFile: filepath.Join(dir, "missing.key")}.newTLSConfig()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "loading client certificate")
+
+	cfg, err := TLSConfig{CAFile: filepath.Join(dir, "ca.crt"), ServerName: "foo.com", MinVersion: "TLS12"}.newTLSConfig()
+	require.NoError(t, err)
+	require.NotNil(t, cfg.RootCAs)
+	require.Equal(t, "foo.com", cfg.ServerName)
+	require.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+}
@@ -0,0 +1,136 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// The phases of an HTTP request, as exported by the phase metric.
+const (
+	// Resolving the host name.
+	PhaseDNS = "dns"
+	// Establishing the TCP connection.
+	PhaseConnect = "connect"
+	// The TLS handshake.
+	PhaseTLS = "tls"
+	// From the request being written to the first byte of the response.
+	PhaseTTFB = "ttfb"
+	// From the first byte of the response until its body is read.
+	PhaseTransfer = "transfer"
+)
+
+// The phases of a WebSocket probe, besides those of its handshake request.
+const (
+	// The whole handshake, from dialing until the connection is upgraded.
+	PhaseHandshake = "handshake"
+	// From the message being sent until the expected reply is read.
+	PhaseRoundTrip = "round_trip"
+)
+
+// phases lists the phases in the order of a request.
+var phases = []string{PhaseDNS, PhaseConnect, PhaseTLS, PhaseTTFB, PhaseTransfer}
+
+// exportedPhases lists the phases of all probes in the order they are
+// exported.
+var exportedPhases = append(append([]string(nil), phases...), PhaseHandshake, PhaseRoundTrip)
+
+// phaseTrace records the durations of the phases of a request. Durations of
+// phases happening more than once, such as on redirects, are summed up.
+type phaseTrace struct {
+	// The hooks may be called concurrently, such as when dialing several
+	// addresses of a host.
+	mtx sync.Mutex
+
+	dnsStart     time.Time
+	connectStart map[string]time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+
+	durations map[string]time.Duration
+}
+
+// newPhaseTrace creates an empty trace.
+func newPhaseTrace() *phaseTrace {
+	return &phaseTrace{
+		connectStart: map[string]time.Time{},
+		durations:    map[string]time.Duration{},
+	}
+}
+
+// withContext returns a context which records the phases of the requests
+// made with it into the trace.
+func (t *phaseTrace) withContext(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(func(now time.Time) { t.dnsStart = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(func(now time.Time) { t.add(PhaseDNS, t.dnsStart, now) })
+		},
+		ConnectStart: func(network, addr string) {
+			t.record(func(now time.Time) { t.connectStart[network+addr] = now })
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				return
+			}
+			t.record(func(now time.Time) { t.add(PhaseConnect, t.connectStart[network+addr], now) })
+		},
+		TLSHandshakeStart: func() {
+			t.record(func(now time.Time) { t.tlsStart = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.record(func(now time.Time) { t.add(PhaseTLS, t.tlsStart, now) })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.record(func(now time.Time) { t.wroteRequest = now })
+		},
+		GotFirstResponseByte: func() {
+			t.record(func(now time.Time) {
+				t.firstByte = now
+				t.add(PhaseTTFB, t.wroteRequest, now)
+			})
+		},
+	})
+}
+
+// record calls f with the current time under the lock of the trace.
+func (t *phaseTrace) record(f func(now time.Time)) {
+	now := time.Now()
+	t.mtx.Lock()
+	f(now)
+	t.mtx.Unlock()
+}
+
+// add adds the duration of a phase. Phases whose start was missed are
+// skipped.
+func (t *phaseTrace) add(phase string, start, end time.Time) {
+	if start.IsZero() {
+		return
+	}
+	t.durations[phase] += end.Sub(start)
+}
+
+// bodyRead ends the transfer phase of the last response.
+func (t *phaseTrace) bodyRead() {
+	t.record(func(now time.Time) { t.add(PhaseTransfer, t.firstByte, now) })
+}
+
+// phaseDurations returns the durations of the phases which happened.
+func (t *phaseTrace) phaseDurations() map[string]time.Duration {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if len(t.durations) == 0 {
+		return nil
+	}
+	durations := make(map[string]time.Duration, len(t.durations))
+	for phase, d := range t.durations {
+		durations[phase] = d
+	}
+	return durations
+}
@@ -0,0 +1,57 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arriqaaq/boomerang"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetScraperScrapePhases(t *testing.T) {
+	server := httptest.NewTLSServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte("ok"))
+		}),
+	)
+	defer server.Close()
+
+	// Use the host name to have it resolved.
+	serverURL, err := url.Parse(strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	require.NoError(t, err)
+
+	transport := boomerang.DefaultTransport()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	ts := &targetScraper{
+		Target: NewTarget(serverURL),
+		client: boomerang.NewHttpClient(&boomerang.ClientConfig{
+			Transport:  transport,
+			MaxRetries: 1,
+		}),
+	}
+
+	require.NoError(t, ts.scrape(context.Background()))
+
+	var resp TargetResponse
+	ts.annotate(&resp)
+	for _, phase := range phases {
+		require.Contains(t, resp.Phases, phase)
+	}
+	require.GreaterOrEqual(t, int64(resp.Phases[PhaseTTFB]), int64(20*time.Millisecond))
+}
+
+func TestPhaseTraceMissedStart(t *testing.T) {
+	trace := newPhaseTrace()
+	require.Nil(t, trace.phaseDurations())
+
+	// Without a first byte there is no transfer to time.
+	trace.bodyRead()
+	require.Nil(t, trace.phaseDurations())
+}
@@ -0,0 +1,175 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// WebSocketConfig configures the probes of ws:// and wss:// targets. The
+// handshake request carries the headers of the scrape config, and wss://
+// targets are connected to with its tls_config.
+type WebSocketConfig struct {
+	// A text message sent once the connection is upgraded.
+	Send string `yaml:"send"`
+	// A regular expression a message read from the connection must match.
+	// Messages are read until one matches.
+	Expect string `yaml:"expect"`
+}
+
+// validate checks the regular expression.
+func (c WebSocketConfig) validate(pos position) error {
+	if _, err := regexp.Compile(c.Expect); err != nil {
+		return pos.key("expect").errorf("invalid regexp %q: %s", c.Expect, err)
+	}
+	return nil
+}
+
+// webSocketScraper implements the scraper interface for ws:// and wss://
+// targets.
+type webSocketScraper struct {
+	*Target
+	proberTLS
+
+	config     WebSocketConfig
+	httpConfig HTTPConfig
+	// The compiled Expect of the config, nil without one.
+	expect *regexp.Regexp
+	// The error compiling the regexp of the config, returned by every
+	// scrape.
+	compileErr error
+
+	// The durations of the phases of the last probe.
+	lastPhases map[string]time.Duration
+	// The status code of the last handshake response.
+	lastStatusCode int
+}
+
+// newWebSocketScraper creates a scraper of the ws:// or wss:// target with
+// the config, compiling its regexp. The handshake uses the headers and proxy
+// of the HTTP config, and wss:// targets its TLS config.
+func newWebSocketScraper(t *Target, config WebSocketConfig, httpConfig HTTPConfig) *webSocketScraper {
+	s := &webSocketScraper{
+		Target:     t,
+		config:     config,
+		httpConfig: httpConfig,
+	}
+	if t.URL().Scheme == "wss" {
+		s.proberTLS = newProberTLS(t, httpConfig)
+	}
+	if config.Expect != "" {
+		if s.expect, s.compileErr = regexp.Compile(config.Expect); s.compileErr != nil {
+			s.compileErr = errors.Errorf("expect: invalid regexp %q: %s", config.Expect, s.compileErr)
+			log.Println("msg", "Compiling regexps failed", "target", t.URL(), "err", s.compileErr)
+		}
+	}
+	return s
+}
+
+// url returns the target's URL.
+func (s *webSocketScraper) url() *url.URL {
+	return s.URL()
+}
+
+// labels returns the target's labels.
+func (s *webSocketScraper) labels() map[string]string {
+	return s.Labels()
+}
+
+// annotate adds the phase durations, handshake status code and certificate
+// chain of the last probe.
+func (s *webSocketScraper) annotate(resp *TargetResponse) {
+	resp.Phases = s.lastPhases
+	resp.StatusCode = s.lastStatusCode
+	resp.Cert = s.lastCert
+}
+
+// scrape performs the handshake with the target and, if configured, sends
+// the message and waits for the expected reply.
+func (s *webSocketScraper) scrape(ctx context.Context) error {
+	s.lastPhases, s.lastStatusCode, s.lastCert = nil, 0, nil
+	if s.tlsErr != nil {
+		return s.tlsErr
+	}
+	if s.compileErr != nil {
+		return s.compileErr
+	}
+
+	header := make(http.Header, len(s.httpConfig.Headers))
+	for name, value := range s.httpConfig.Headers {
+		header.Set(name, value)
+	}
+	dialer := &websocket.Dialer{
+		TLSClientConfig: s.tlsConfig,
+		Proxy:           s.httpConfig.proxyFunc(),
+	}
+	if dialer.Proxy == nil {
+		dialer.Proxy = http.ProxyFromEnvironment
+	}
+
+	trace := newPhaseTrace()
+	defer func() {
+		s.lastPhases = trace.phaseDurations()
+	}()
+	start := time.Now()
+	conn, resp, err := dialer.DialContext(trace.withContext(ctx), s.URL().String(), header)
+	if resp != nil {
+		s.lastStatusCode = resp.StatusCode
+	}
+	if err != nil {
+		if err == websocket.ErrBadHandshake && resp != nil {
+			return errors.Errorf("handshake failed with status %s", resp.Status)
+		}
+		return errors.Wrap(err, "handshake")
+	}
+	defer conn.Close()
+	trace.record(func(now time.Time) { trace.add(PhaseHandshake, start, now) })
+
+	if state, ok := conn.UnderlyingConn().(*tls.Conn); ok {
+		cs := state.ConnectionState()
+		if s.lastCert = certInfo(&cs); s.lastCert != nil {
+			if err := s.lastCert.checkExpiry(s.certExpiryWindow, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	start = time.Now()
+	if s.config.Send != "" {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(s.config.Send)); err != nil {
+			return errors.Wrap(err, "sending message")
+		}
+	}
+	if s.expect != nil {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return errors.Wrapf(err, "expected regexp %q not found", s.config.Expect)
+			}
+			if s.expect.Match(msg) {
+				break
+			}
+		}
+		trace.record(func(now time.Time) { trace.add(PhaseRoundTrip, start, now) })
+	}
+
+	// The close handshake is best effort; the probe succeeded regardless.
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return nil
+}
@@ -0,0 +1,150 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// serveWebSocket upgrades connections to /ws, greets and echoes messages.
+// The handshake requires an X-Token header of "secret".
+func serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ws" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("X-Token") != "secret" {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var upgrader websocket.Upgrader
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+	for {
+		typ, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(typ, msg)
+	}
+}
+
+func TestWebSocketScraperScrape(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serveWebSocket))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for _, c := range []struct {
+		name    string
+		url     string
+		headers map[string]string
+		config  WebSocketConfig
+		phases  []string
+		err     string
+	}{
+		{
+			name:    "handshake",
+			url:     wsURL + "/ws",
+			headers: map[string]string{"X-Token": "secret"},
+			phases:  []string{PhaseConnect, PhaseTTFB, PhaseHandshake},
+		},
+		{
+			name:    "greeting",
+			url:     wsURL + "/ws",
+			headers: map[string]string{"X-Token": "secret"},
+			config:  WebSocketConfig{Expect: "^hello$"},
+			phases:  []string{PhaseConnect, PhaseTTFB, PhaseHandshake, PhaseRoundTrip},
+		},
+		{
+			name:    "echo",
+			url:     wsURL + "/ws",
+			headers: map[string]string{"X-Token": "secret"},
+			config:  WebSocketConfig{Send: "ping 42", Expect: "^ping \\d+$"},
+			phases:  []string{PhaseConnect, PhaseTTFB, PhaseHandshake, PhaseRoundTrip},
+		},
+		{
+			name:    "missing reply",
+			url:     wsURL + "/ws",
+			headers: map[string]string{"X-Token": "secret"},
+			config:  WebSocketConfig{Send: "ping", Expect: "^pong$"},
+			phases:  []string{PhaseConnect, PhaseTTFB, PhaseHandshake},
+			err:     `expected regexp "^pong$" not found`,
+		},
+		{
+			name:   "forbidden",
+			url:    wsURL + "/ws",
+			phases: []string{PhaseConnect, PhaseTTFB},
+			err:    "handshake failed with status 403 Forbidden",
+		},
+		{
+			name:    "not found",
+			url:     wsURL + "/chat",
+			headers: map[string]string{"X-Token": "secret"},
+			phases:  []string{PhaseConnect, PhaseTTFB},
+			err:     "handshake failed with status 404 Not Found",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			targetURL, err := url.Parse(c.url)
+			require.NoError(t, err)
+			ws := newWebSocketScraper(NewTarget(targetURL), c.config, HTTPConfig{Headers: c.headers})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			err = ws.scrape(ctx)
+			if c.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.err)
+			}
+
+			var resp TargetResponse
+			ws.annotate(&resp)
+			require.NotZero(t, resp.StatusCode)
+			require.Len(t, resp.Phases, len(c.phases))
+			for _, phase := range c.phases {
+				require.Contains(t, resp.Phases, phase)
+			}
+		})
+	}
+}
+
+func TestWebSocketScraperScrapeTLS(t *testing.T) {
+	// The test server provides a certificate for example.com.
+	server := httptest.NewTLSServer(http.HandlerFunc(serveWebSocket))
+	defer server.Close()
+
+	targetURL, _ := url.Parse("wss" + strings.TrimPrefix(server.URL, "https") + "/ws")
+	ws := newWebSocketScraper(NewTarget(targetURL),
+		WebSocketConfig{Send: "ping", Expect: "^ping$"},
+		HTTPConfig{Headers: map[string]string{"X-Token": "secret"}},
+	)
+	ws.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	require.NoError(t, ws.scrape(context.Background()))
+
+	var resp TargetResponse
+	ws.annotate(&resp)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Contains(t, resp.Phases, PhaseTLS)
+	require.NotNil(t, resp.Cert)
+	require.Contains(t, resp.Cert.SANs, "example.com")
+
+	// The certificate of the test server is not trusted by default.
+	ws.tlsConfig = &tls.Config{}
+	err := ws.scrape(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "certificate")
+}